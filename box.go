@@ -1,9 +1,9 @@
 package tnt
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -22,23 +23,65 @@ const (
 
 // Box is a tarantool instance with specified config and BoxOptions.
 type Box struct {
-	Root     string
-	Port     uint
-	cmd      *exec.Cmd
-	stopOnce sync.Once
-	stopped  chan bool
+	Root         string
+	Port         uint
+	confFile     string
+	binary       string
+	startTimeout time.Duration
+	logs         *logRing
+	mu           sync.Mutex
+	cmd          *exec.Cmd // nil if process is not running
+	exited       chan bool // closed when process of cmd exits
+	paused       bool
+	stopOnce     sync.Once
+	stopped      chan bool
 }
 
+var (
+	// ErrBoxRunning means Start of the running box.
+	ErrBoxRunning = errors.New("box is running already")
+	// ErrBoxNotRunning means signal to the stopped box.
+	ErrBoxNotRunning = errors.New("box is not running")
+
+	errBoxPortInUse = errors.New("port is already in use")
+)
+
 // BoxOptions is the options for the Box instance.
 type BoxOptions struct {
 	Listen  uint
 	PortMin uint
 	PortMax uint
 	InitLua string
+	// Binary is the tarantool executable, "tarantool_box" from PATH by default.
+	Binary string
+	// StartTimeout limits the wait for the box to answer ping, 10 seconds by default.
+	StartTimeout time.Duration
+	// LogSize is the size of the stderr buffer returned by Box.Logs, 64KB by default.
+	LogSize int
 }
 
-// NewBox instance.
+// boxDefaultSettings are used by NewBox before the user config.
+const boxDefaultSettings = `
+		slab_alloc_arena = 1
+		slab_alloc_factor = 1.04
+		memcached_expire = false
+`
+
+// NewBox instance. Config is appended to the default settings.
 func NewBox(config string, options ...BoxOptions) (*Box, error) {
+	return newBox(fmt.Sprintf("%s\n%s", boxDefaultSettings, config), options...)
+}
+
+// NewBoxWithConfig validates and renders cfg and starts Box instance with it.
+func NewBoxWithConfig(cfg *BoxConfig, options ...BoxOptions) (*Box, error) {
+	config, err := cfg.Render()
+	if err != nil {
+		return nil, err
+	}
+	return newBox(config, options...)
+}
+
+func newBox(config string, options ...BoxOptions) (*Box, error) {
 	var opts BoxOptions
 	if len(options) > 0 {
 		opts = options[0]
@@ -59,10 +102,23 @@ func NewBox(config string, options ...BoxOptions) (*Box, error) {
 		opts.PortMax = opts.Listen
 	}
 
+	if opts.Binary == "" {
+		opts.Binary = "tarantool_box"
+	}
+
+	if opts.StartTimeout == 0 {
+		opts.StartTimeout = 10 * time.Second
+	}
+
+	if opts.LogSize == 0 {
+		opts.LogSize = 64 * 1024
+	}
+
 	var box *Box
 
 START_LOOP:
-	for port := opts.PortMin; port <= opts.PortMax; port += 3 {
+	// every box takes 4 ports: primary, memcached, admin and replication
+	for port := opts.PortMin; port <= opts.PortMax; port += 4 {
 
 		tmpDir, err := ioutil.TempDir("", "")
 		if err != nil {
@@ -70,9 +126,6 @@ START_LOOP:
 		}
 
 		tarantoolConf := `
-		slab_alloc_arena = 1
-		slab_alloc_factor = 1.04
-
 		pid_file = {root}/box.pid
 		work_dir = {root}
 		snap_dir = {snap}
@@ -83,7 +136,6 @@ START_LOOP:
 		too_long_threshold = 0.025
 
 		primary_port = {port1}
-		memcached_expire = false
 		memcached_port = {port2}
 		admin_port = {port3}
 		replication_port = {port4}
@@ -115,63 +167,199 @@ START_LOOP:
 			}
 		}
 
-		cmd0 := exec.Command("tarantool_box", "-c", tarantoolConfFile, "--init-storage")
-		if err = cmd0.Run(); err != nil {
-			return nil, err
+		cmd0 := exec.Command(opts.Binary, "-c", tarantoolConfFile, "--init-storage")
+		if out, err := cmd0.CombinedOutput(); err != nil {
+			os.RemoveAll(tmpDir)
+			return nil, fmt.Errorf("%s: %s", err, out)
 		}
 
-		cmd := exec.Command("tarantool_box", "-c", tarantoolConfFile)
-		boxStderr, err := cmd.StderrPipe()
-		if err != nil {
-			return nil, err
+		box = &Box{
+			Root:         tmpDir,
+			Port:         port,
+			confFile:     tarantoolConfFile,
+			binary:       opts.Binary,
+			startTimeout: opts.StartTimeout,
+			logs:         newLogRing(opts.LogSize),
+			stopped:      make(chan bool),
 		}
 
-		if err = cmd.Start(); err != nil {
+		err = box.startProcess()
+		if err == nil {
+			break START_LOOP
+		}
+
+		os.RemoveAll(box.Root)
+		box = nil
+
+		if err != errBoxPortInUse {
 			return nil, err
 		}
+	}
 
-		var boxStderrBuffer bytes.Buffer
+	if box == nil {
+		return nil, fmt.Errorf("couldn't bind any port from %d to %d", opts.PortMin, opts.PortMax)
+	}
 
-		p := make([]byte, 1024)
+	return box, nil
+}
 
-		box = &Box{
-			Root:    tmpDir,
-			Port:    port,
-			cmd:     cmd,
-			stopped: make(chan bool),
+// startProcess runs tarantool and waits until it answers ping.
+// Must be called with box.mu held or before box is shared.
+func (box *Box) startProcess() error {
+	cmd := exec.Command(box.binary, "-c", box.confFile)
+	boxStderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	logStart := box.logs.Written()
+
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan bool)
+	go func() {
+		// tarantool blocks on the full stderr pipe, so it is read until the process exits
+		io.Copy(box.logs, boxStderr)
+		cmd.Wait()
+		close(exited)
+	}()
+
+	kill := func() {
+		cmd.Process.Kill()
+		<-exited
+	}
+
+	deadline := time.Now().Add(box.startTimeout)
+
+	for {
+		logs := box.logs.Since(logStart)
+		if strings.Contains(logs, "is already in use, will retry binding after") {
+			kill()
+			return errBoxPortInUse
 		}
 
-	WAIT_LOOP:
-		for {
-			if strings.Contains(boxStderrBuffer.String(), "is already in use, will retry binding after") {
-				cmd.Process.Kill()
-				cmd.Process.Wait()
-				break WAIT_LOOP
-			}
+		// ping may be answered by someone else on the port before the box reports binding error
+		if strings.Contains(logs, "entering event loop") && box.ping() == nil {
+			break
+		}
 
-			if strings.Contains(boxStderrBuffer.String(), "entering event loop") {
-				break START_LOOP
-			}
+		if time.Now().After(deadline) {
+			kill()
+			return fmt.Errorf("box hasn't started in %s:\n%s", box.startTimeout, box.logs.Since(logStart))
+		}
 
-			n, err := boxStderr.Read(p)
-			if n > 0 {
-				boxStderrBuffer.Write(p[:n])
-			}
-			if err != nil {
-				fmt.Println(boxStderrBuffer.String())
-				return nil, err
-			}
+		select {
+		case <-exited:
+			return fmt.Errorf("box has exited while starting:\n%s", box.logs.Since(logStart))
+		case <-time.After(10 * time.Millisecond):
+			// pass
 		}
+	}
 
-		os.RemoveAll(box.Root)
-		box = nil
+	box.cmd = cmd
+	box.exited = exited
+	box.paused = false
+	return nil
+}
+
+func (box *Box) ping() error {
+	conn, err := Connect(box.Listen(), &Options{
+		ConnectTimeout: 100 * time.Millisecond,
+		QueryTimeout:   100 * time.Millisecond,
+	})
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
 
-	if box == nil {
-		return nil, fmt.Errorf("couldn't bind any port from %d to %d", opts.PortMin, opts.PortMax)
+	_, err = conn.Execute(&Ping{})
+	return err
+}
+
+// signal sends sig to the running process and waits for its exit if wait is true.
+func (box *Box) signal(sig os.Signal, wait bool) error {
+	box.mu.Lock()
+	defer box.mu.Unlock()
+
+	if box.cmd == nil {
+		return ErrBoxNotRunning
 	}
 
-	return box, nil
+	if err := box.cmd.Process.Signal(sig); err != nil {
+		return err
+	}
+
+	if !wait {
+		return nil
+	}
+
+	// stopped process doesn't handle signals until it is continued
+	if box.paused && sig != os.Kill {
+		box.cmd.Process.Signal(sigCont)
+	}
+
+	<-box.exited
+	box.cmd = nil
+	box.paused = false
+	return nil
+}
+
+// Stop terminates the tarantool process gracefully. Data and ports of the box are kept for Start.
+func (box *Box) Stop() error {
+	return box.signal(syscall.SIGTERM, true)
+}
+
+// Crash kills the tarantool process without any cleanup. Data written to WAL is kept for Start.
+func (box *Box) Crash() error {
+	return box.signal(os.Kill, true)
+}
+
+// Start runs the stopped tarantool process again with the same root and ports.
+func (box *Box) Start() error {
+	box.mu.Lock()
+	defer box.mu.Unlock()
+
+	if box.cmd != nil {
+		return ErrBoxRunning
+	}
+
+	err := box.startProcess()
+	if err == errBoxPortInUse {
+		return fmt.Errorf("couldn't bind port %d: %s", box.Port, err)
+	}
+	return err
+}
+
+// Restart stops and starts the tarantool process keeping its data.
+func (box *Box) Restart() error {
+	if err := box.Stop(); err != nil {
+		return err
+	}
+	return box.Start()
+}
+
+// Pause freezes the tarantool process with SIGSTOP. Connections stay open, but nothing is replied.
+func (box *Box) Pause() error {
+	if err := box.signal(sigStop, false); err != nil {
+		return err
+	}
+	box.mu.Lock()
+	box.paused = true
+	box.mu.Unlock()
+	return nil
+}
+
+// Resume continues the paused tarantool process with SIGCONT.
+func (box *Box) Resume() error {
+	if err := box.signal(sigCont, false); err != nil {
+		return err
+	}
+	box.mu.Lock()
+	box.paused = false
+	box.mu.Unlock()
+	return nil
 }
 
 // Listen is the primary addr of the box.
@@ -257,11 +445,92 @@ func (box *Box) Snapshot() (string, error) {
 	return "", ErrSnapshotNotFound
 }
 
-// Close Box instance.
+// Logs returns the tail of the tarantool stderr including all the restarts.
+func (box *Box) Logs() string {
+	return box.logs.String()
+}
+
+// TestingT is the part of testing.TB needed by LogOnFailure, so programs using the package don't link testing.
+type TestingT interface {
+	Cleanup(func())
+	Failed() bool
+	Logf(format string, args ...interface{})
+}
+
+// LogOnFailure prints Logs of the box to t at the end of the failed test.
+func (box *Box) LogOnFailure(t TestingT) {
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("box %s logs:\n%s", box.Listen(), box.Logs())
+		}
+	})
+}
+
+// logRing keeps the last written bytes.
+type logRing struct {
+	sync.Mutex
+	buf     []byte
+	written int64
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{buf: make([]byte, size)}
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.Lock()
+	n := len(p)
+	if len(p) > len(r.buf) {
+		r.written += int64(len(p) - len(r.buf))
+		p = p[len(p)-len(r.buf):]
+	}
+	for len(p) > 0 {
+		c := copy(r.buf[r.written%int64(len(r.buf)):], p)
+		r.written += int64(c)
+		p = p[c:]
+	}
+	r.Unlock()
+	return n, nil
+}
+
+// Written returns the number of bytes ever written.
+func (r *logRing) Written() int64 {
+	r.Lock()
+	defer r.Unlock()
+	return r.written
+}
+
+// Since returns kept bytes written after the offset returned by Written.
+func (r *logRing) Since(offset int64) string {
+	r.Lock()
+	defer r.Unlock()
+
+	size := int64(len(r.buf))
+	if offset < r.written-size {
+		offset = r.written - size
+	}
+
+	out := make([]byte, 0, r.written-offset)
+	for i := offset; i < r.written; {
+		start := i % size
+		end := size
+		if r.written-i < end-start {
+			end = start + (r.written - i)
+		}
+		out = append(out, r.buf[start:end]...)
+		i += end - start
+	}
+	return string(out)
+}
+
+func (r *logRing) String() string {
+	return r.Since(0)
+}
+
+// Close Box instance. The process is killed and all the data is removed.
 func (box *Box) Close() {
 	box.stopOnce.Do(func() {
-		box.cmd.Process.Kill()
-		box.cmd.Process.Wait()
+		box.Crash()
 		os.RemoveAll(box.Root)
 		close(box.stopped)
 	})
@@ -0,0 +1,159 @@
+package tnt
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BoxCluster is a master Box with replicas connected to its replication port.
+type BoxCluster struct {
+	Master   *Box
+	Replicas []*Box
+}
+
+// NewBoxCluster starts master with config and given number of replicas with the same config.
+// Listen of options is ignored since every box needs its own ports.
+func NewBoxCluster(config string, replicas int, options ...BoxOptions) (*BoxCluster, error) {
+	var opts BoxOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Listen = 0
+
+	master, err := NewBox(config, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &BoxCluster{
+		Master: master,
+	}
+
+	replicaConfig := fmt.Sprintf("%s\nreplication_source = %q\n", config, master.ListenReplica())
+	for i := 0; i < replicas; i++ {
+		replica, err := NewBox(replicaConfig, opts)
+		if err != nil {
+			cluster.Close()
+			return nil, err
+		}
+		cluster.Replicas = append(cluster.Replicas, replica)
+	}
+
+	return cluster, nil
+}
+
+// WaitSync waits until LSN of every replica reaches the current master LSN.
+func (c *BoxCluster) WaitSync(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	masterLSN, err := c.Master.LSN()
+	if err != nil {
+		return err
+	}
+
+	for _, replica := range c.Replicas {
+		for {
+			lsn, err := replica.LSN()
+			if err != nil {
+				return err
+			}
+			if lsn >= masterLSN {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("replica %s is at LSN %d behind master LSN %d", replica.Listen(), lsn, masterLSN)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return nil
+}
+
+// Boxes returns master and replicas.
+func (c *BoxCluster) Boxes() []*Box {
+	return append([]*Box{c.Master}, c.Replicas...)
+}
+
+// Close all the boxes of the cluster.
+func (c *BoxCluster) Close() {
+	for _, replica := range c.Replicas {
+		replica.Close()
+	}
+	c.Master.Close()
+}
+
+// NewBoxShards starts n independent boxes with identical config.
+// Listen of options is ignored since every box needs its own ports.
+func NewBoxShards(config string, n int, options ...BoxOptions) ([]*Box, error) {
+	var opts BoxOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Listen = 0
+
+	shards := make([]*Box, 0, n)
+	for i := 0; i < n; i++ {
+		box, err := NewBox(config, opts)
+		if err != nil {
+			for _, shard := range shards {
+				shard.Close()
+			}
+			return nil, err
+		}
+		shards = append(shards, box)
+	}
+
+	return shards, nil
+}
+
+// AdminCommand sends command to the admin port and returns YAML reply.
+func (box *Box) AdminCommand(command string) (string, error) {
+	conn, err := net.Dial("tcp", box.ListenAdmin())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return "", err
+	}
+	if _, err = fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return "", err
+	}
+
+	// reply is a YAML document terminated by "..." line
+	var reply []string
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "..." {
+			return strings.Join(reply, "\n"), nil
+		}
+		reply = append(reply, line)
+	}
+}
+
+// LSN returns the log sequence number of the box from "show info".
+func (box *Box) LSN() (int64, error) {
+	info, err := box.AdminCommand("show info")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "lsn:") {
+			return strconv.ParseInt(strings.TrimSpace(line[len("lsn:"):]), 10, 64)
+		}
+	}
+
+	return 0, fmt.Errorf("lsn not found in box info: %s", info)
+}
@@ -0,0 +1,68 @@
+package tnt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoxCluster(t *testing.T) {
+	require := require.New(t)
+
+	config := `
+	space[0].enabled = 1
+	space[0].index[0].type = "HASH"
+	space[0].index[0].unique = 1
+	space[0].index[0].key_field[0].fieldno = 0
+	space[0].index[0].key_field[0].type = "NUM"
+    `
+
+	cluster, err := NewBoxCluster(config, 2)
+	require.NoError(err)
+	defer cluster.Close()
+
+	for _, box := range cluster.Boxes() {
+		box.LogOnFailure(t)
+	}
+
+	conn, err := Connect(cluster.Master.Listen(), nil)
+	require.NoError(err)
+	defer conn.Close()
+
+	_, err = conn.Execute(&Insert{Space: 0, Tuple: Tuple{PackInt(1)}})
+	require.NoError(err)
+
+	require.NoError(cluster.WaitSync(5 * time.Second))
+
+	for _, replica := range cluster.Replicas {
+		replicaConn, err := Connect(replica.Listen(), nil)
+		require.NoError(err)
+
+		data, err := replicaConn.Execute(&Select{Space: 0, Value: PackInt(1)})
+		require.NoError(err)
+		require.Len(data, 1)
+		replicaConn.Close()
+	}
+}
+
+func TestBoxShards(t *testing.T) {
+	require := require.New(t)
+
+	shards, err := NewBoxShards(`
+	space[0].enabled = 1
+	space[0].index[0].type = "HASH"
+	space[0].index[0].unique = 1
+	space[0].index[0].key_field[0].fieldno = 0
+	space[0].index[0].key_field[0].type = "NUM"
+    `, 3)
+	require.NoError(err)
+	require.Len(shards, 3)
+
+	ports := make(map[uint]bool)
+	for _, shard := range shards {
+		require.False(ports[shard.Port])
+		ports[shard.Port] = true
+		shard.Close()
+	}
+}
@@ -0,0 +1,234 @@
+package tnt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// IndexType is the type of space index.
+type IndexType string
+
+const (
+	Hash IndexType = "HASH"
+	Tree IndexType = "TREE"
+)
+
+// FieldType is the type of tuple field.
+type FieldType string
+
+const (
+	Num   FieldType = "NUM"
+	Num64 FieldType = "NUM64"
+	Str   FieldType = "STR"
+)
+
+// WALMode is the write ahead log mode of the box.
+type WALMode string
+
+const (
+	WALNone       WALMode = "none"
+	WALWrite      WALMode = "write"
+	WALFsync      WALMode = "fsync"
+	WALFsyncDelay WALMode = "fsync_delay"
+)
+
+// Part is the key part of index.
+type Part struct {
+	Field uint32    `json:"field"`
+	Type  FieldType `json:"type"`
+}
+
+// IndexConfig is the config of space index.
+type IndexConfig struct {
+	Type   IndexType `json:"type"`
+	Unique bool      `json:"unique"`
+	Parts  []Part    `json:"parts"`
+}
+
+// SpaceConfig is the config of space. The first index is the primary key.
+// It is the space description of Schema as well.
+type SpaceConfig struct {
+	ID uint32 `json:"id"`
+	// Cardinality is the number of fields in every tuple, 0 means any.
+	Cardinality uint32        `json:"cardinality,omitempty"`
+	Indexes     []IndexConfig `json:"indexes,omitempty"`
+	// Name and Fields are used by clients only, they are not rendered to tarantool.cfg.
+	Name   string        `json:"name,omitempty"`
+	Fields []FieldConfig `json:"fields,omitempty"`
+}
+
+// BoxConfig is the Go-native form of tarantool.cfg settings which are not managed by Box itself
+// (ports and directories).
+type BoxConfig struct {
+	Spaces []SpaceConfig
+	// SlabAllocArena is the memory size in gigabytes, 1 by default.
+	SlabAllocArena float64
+	// SlabAllocFactor is the slab size multiplier, 1.04 by default.
+	SlabAllocFactor float64
+	// WALMode is the tarantool default if empty.
+	WALMode WALMode
+	// MemcachedSpace is the space of memcached port, 23 by default. It must not be among Spaces.
+	MemcachedSpace uint32
+	// MemcachedExpire turns on expiration of memcached items by the box.
+	MemcachedExpire bool
+	// MemcachedExpirePerLoop is the number of items checked per expiration loop, tarantool default if 0.
+	MemcachedExpirePerLoop uint32
+}
+
+func (c *BoxConfig) memcachedSpace() uint32 {
+	if c.MemcachedSpace == 0 {
+		return 23
+	}
+	return c.MemcachedSpace
+}
+
+// Validate checks the config for errors the box would fail to start with.
+func (c *BoxConfig) Validate() error {
+	if c.SlabAllocArena < 0 {
+		return fmt.Errorf("slab_alloc_arena must be positive: %v", c.SlabAllocArena)
+	}
+
+	if c.SlabAllocFactor != 0 && (c.SlabAllocFactor <= 1 || c.SlabAllocFactor > 2) {
+		return fmt.Errorf("slab_alloc_factor must be in (1, 2]: %v", c.SlabAllocFactor)
+	}
+
+	switch c.WALMode {
+	case "", WALNone, WALWrite, WALFsync, WALFsyncDelay:
+		// pass
+	default:
+		return fmt.Errorf("unknown wal_mode: %q", c.WALMode)
+	}
+
+	spaces := make(map[uint32]bool)
+	for _, space := range c.Spaces {
+		if spaces[space.ID] {
+			return fmt.Errorf("space[%d] is defined twice", space.ID)
+		}
+		spaces[space.ID] = true
+
+		if space.ID == c.memcachedSpace() {
+			return fmt.Errorf("space[%d] is used as memcached_space", space.ID)
+		}
+
+		if err := space.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SpaceConfig) validate() error {
+	if len(s.Indexes) == 0 {
+		return fmt.Errorf("space[%d] has no indexes", s.ID)
+	}
+
+	for i, index := range s.Indexes {
+		switch index.Type {
+		case Hash:
+			if !index.Unique {
+				return fmt.Errorf("space[%d].index[%d]: HASH index must be unique", s.ID, i)
+			}
+		case Tree:
+			// pass
+		default:
+			return fmt.Errorf("space[%d].index[%d]: unknown index type %q", s.ID, i, index.Type)
+		}
+
+		if i == 0 && !index.Unique {
+			return fmt.Errorf("space[%d].index[0]: primary index must be unique", s.ID)
+		}
+
+		if len(index.Parts) == 0 {
+			return fmt.Errorf("space[%d].index[%d] has no key fields", s.ID, i)
+		}
+
+		fields := make(map[uint32]bool)
+		for j, part := range index.Parts {
+			switch part.Type {
+			case Num, Num64, Str:
+				// pass
+			default:
+				return fmt.Errorf("space[%d].index[%d].key_field[%d]: unknown field type %q", s.ID, i, j, part.Type)
+			}
+
+			if fields[part.Field] {
+				return fmt.Errorf("space[%d].index[%d].key_field[%d]: field %d is used twice", s.ID, i, j, part.Field)
+			}
+			fields[part.Field] = true
+
+			if s.Cardinality != 0 && part.Field >= s.Cardinality {
+				return fmt.Errorf("space[%d].index[%d].key_field[%d]: field %d is out of cardinality", s.ID, i, j, part.Field)
+			}
+		}
+	}
+
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// Render validates config and returns it in tarantool.cfg syntax.
+func (c *BoxConfig) Render() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+
+	slabAllocArena := c.SlabAllocArena
+	if slabAllocArena == 0 {
+		slabAllocArena = 1
+	}
+
+	slabAllocFactor := c.SlabAllocFactor
+	if slabAllocFactor == 0 {
+		slabAllocFactor = 1.04
+	}
+
+	fmt.Fprintf(&buf, "slab_alloc_arena = %s\n", formatFloat(slabAllocArena))
+	fmt.Fprintf(&buf, "slab_alloc_factor = %s\n", formatFloat(slabAllocFactor))
+	if c.WALMode != "" {
+		fmt.Fprintf(&buf, "wal_mode = %q\n", c.WALMode)
+	}
+	fmt.Fprintf(&buf, "memcached_space = %d\n", c.memcachedSpace())
+	fmt.Fprintf(&buf, "memcached_expire = %s\n", formatBool(c.MemcachedExpire))
+	if c.MemcachedExpirePerLoop != 0 {
+		fmt.Fprintf(&buf, "memcached_expire_per_loop = %d\n", c.MemcachedExpirePerLoop)
+	}
+
+	for _, space := range c.Spaces {
+		prefix := fmt.Sprintf("space[%d]", space.ID)
+		fmt.Fprintf(&buf, "\n%s.enabled = 1\n", prefix)
+		if space.Cardinality != 0 {
+			fmt.Fprintf(&buf, "%s.cardinality = %d\n", prefix, space.Cardinality)
+		}
+
+		for i, index := range space.Indexes {
+			indexPrefix := fmt.Sprintf("%s.index[%d]", prefix, i)
+			unique := 0
+			if index.Unique {
+				unique = 1
+			}
+			fmt.Fprintf(&buf, "%s.type = %q\n", indexPrefix, index.Type)
+			fmt.Fprintf(&buf, "%s.unique = %d\n", indexPrefix, unique)
+
+			for j, part := range index.Parts {
+				fmt.Fprintf(&buf, "%s.key_field[%d].fieldno = %d\n", indexPrefix, j, part.Field)
+				fmt.Fprintf(&buf, "%s.key_field[%d].type = %q\n", indexPrefix, j, part.Type)
+			}
+		}
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,96 @@
+package tnt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoxConfigRender(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := &BoxConfig{
+		Spaces: []SpaceConfig{
+			{
+				ID: 0,
+				Indexes: []IndexConfig{
+					{Type: Hash, Unique: true, Parts: []Part{{Field: 0, Type: Num}}},
+				},
+			},
+			{
+				ID:          1,
+				Cardinality: 3,
+				Indexes: []IndexConfig{
+					{Type: Tree, Unique: true, Parts: []Part{{Field: 0, Type: Num64}, {Field: 2, Type: Str}}},
+					{Type: Tree, Parts: []Part{{Field: 1, Type: Num}}},
+				},
+			},
+		},
+		SlabAllocArena:  0.1,
+		WALMode:         WALNone,
+		MemcachedExpire: true,
+	}
+
+	config, err := cfg.Render()
+	assert.NoError(err)
+	assert.Equal(`slab_alloc_arena = 0.1
+slab_alloc_factor = 1.04
+wal_mode = "none"
+memcached_space = 23
+memcached_expire = true
+
+space[0].enabled = 1
+space[0].index[0].type = "HASH"
+space[0].index[0].unique = 1
+space[0].index[0].key_field[0].fieldno = 0
+space[0].index[0].key_field[0].type = "NUM"
+
+space[1].enabled = 1
+space[1].cardinality = 3
+space[1].index[0].type = "TREE"
+space[1].index[0].unique = 1
+space[1].index[0].key_field[0].fieldno = 0
+space[1].index[0].key_field[0].type = "NUM64"
+space[1].index[0].key_field[1].fieldno = 2
+space[1].index[0].key_field[1].type = "STR"
+space[1].index[1].type = "TREE"
+space[1].index[1].unique = 0
+space[1].index[1].key_field[0].fieldno = 1
+space[1].index[1].key_field[0].type = "NUM"
+`, config)
+}
+
+func TestBoxConfigValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := IndexConfig{Type: Hash, Unique: true, Parts: []Part{{Field: 0, Type: Num}}}
+
+	tests := []struct {
+		cfg BoxConfig
+		err string
+	}{
+		{BoxConfig{SlabAllocFactor: 3}, "slab_alloc_factor must be in (1, 2]: 3"},
+		{BoxConfig{WALMode: "sometimes"}, `unknown wal_mode: "sometimes"`},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Indexes: []IndexConfig{primary}}, {ID: 1, Indexes: []IndexConfig{primary}}}}, "space[1] is defined twice"},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 23, Indexes: []IndexConfig{primary}}}}, "space[23] is used as memcached_space"},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1}}}, "space[1] has no indexes"},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Indexes: []IndexConfig{{Type: Tree, Parts: primary.Parts}}}}}, "space[1].index[0]: primary index must be unique"},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Indexes: []IndexConfig{primary, {Type: Hash, Parts: primary.Parts}}}}}, "space[1].index[1]: HASH index must be unique"},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Indexes: []IndexConfig{{Type: "BITSET", Unique: true, Parts: primary.Parts}}}}}, `space[1].index[0]: unknown index type "BITSET"`},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Indexes: []IndexConfig{{Type: Tree, Unique: true}}}}}, "space[1].index[0] has no key fields"},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Indexes: []IndexConfig{{Type: Tree, Unique: true, Parts: []Part{{Field: 0, Type: "INT"}}}}}}}, `space[1].index[0].key_field[0]: unknown field type "INT"`},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Indexes: []IndexConfig{{Type: Tree, Unique: true, Parts: []Part{{Field: 0, Type: Num}, {Field: 0, Type: Str}}}}}}}, "space[1].index[0].key_field[1]: field 0 is used twice"},
+		{BoxConfig{Spaces: []SpaceConfig{{ID: 1, Cardinality: 1, Indexes: []IndexConfig{{Type: Tree, Unique: true, Parts: []Part{{Field: 1, Type: Num}}}}}}}, "space[1].index[0].key_field[0]: field 1 is out of cardinality"},
+	}
+
+	for _, test := range tests {
+		_, err := test.cfg.Render()
+		if assert.Error(err) {
+			assert.Equal(test.err, err.Error())
+		}
+	}
+
+	// memcached space may be moved away
+	cfg := BoxConfig{MemcachedSpace: 24, Spaces: []SpaceConfig{{ID: 23, Indexes: []IndexConfig{primary}}}}
+	assert.NoError(cfg.Validate())
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package tnt
+
+import "syscall"
+
+var (
+	sigStop = syscall.SIGSTOP
+	sigCont = syscall.SIGCONT
+)
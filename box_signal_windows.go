@@ -0,0 +1,9 @@
+package tnt
+
+import "syscall"
+
+// Pause and Resume of Box are not supported on windows, process signal returns error.
+var (
+	sigStop = syscall.Signal(0x13)
+	sigCont = syscall.Signal(0x12)
+)
@@ -1,8 +1,12 @@
 package tnt
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -56,3 +60,152 @@ func TestBoxSnapshot(t *testing.T) {
 	require.NoError(err)
 	require.Contains(filename, "snap/00000000000000000002.snap")
 }
+
+func TestBoxWithConfig(t *testing.T) {
+	require := require.New(t)
+
+	box, err := NewBoxWithConfig(&BoxConfig{
+		Spaces: []SpaceConfig{{
+			ID:      0,
+			Indexes: []IndexConfig{{Type: Hash, Unique: true, Parts: []Part{{Field: 0, Type: Num}}}},
+		}},
+		WALMode: WALNone,
+	})
+	require.NoError(err)
+	defer box.Close()
+
+	conn, err := Connect(box.Listen(), nil)
+	require.NoError(err)
+	defer conn.Close()
+
+	_, err = conn.Execute(&Insert{Space: 0, Tuple: Tuple{PackInt(1)}})
+	require.NoError(err)
+}
+
+func TestBoxRestart(t *testing.T) {
+	require := require.New(t)
+
+	config := `
+	space[0].enabled = 1
+	space[0].index[0].type = "HASH"
+	space[0].index[0].unique = 1
+	space[0].index[0].key_field[0].fieldno = 0
+	space[0].index[0].key_field[0].type = "NUM"
+    `
+
+	box, err := NewBox(config)
+	require.NoError(err)
+	defer box.Close()
+	box.LogOnFailure(t)
+
+	connector := New(box.Listen(), nil)
+	defer connector.Close()
+
+	conn, err := connector.Connect()
+	require.NoError(err)
+	_, err = conn.Execute(&Insert{Space: 0, Tuple: Tuple{PackInt(1)}})
+	require.NoError(err)
+
+	require.NoError(box.Restart())
+
+	// old connection is closed by the box
+	_, err = conn.Execute(&Select{Space: 0, Value: PackInt(1)})
+	require.IsType(&ConnectionError{}, err)
+
+	conn, err = connector.Connect()
+	require.NoError(err)
+	data, err := conn.Execute(&Select{Space: 0, Value: PackInt(1)})
+	require.NoError(err)
+	require.Len(data, 1)
+
+	// WAL is replayed after crash
+	_, err = conn.Execute(&Insert{Space: 0, Tuple: Tuple{PackInt(2)}})
+	require.NoError(err)
+	require.NoError(box.Crash())
+	require.NoError(box.Start())
+
+	conn, err = connector.Connect()
+	require.NoError(err)
+	data, err = conn.Execute(&Select{Space: 0, Value: PackInt(2)})
+	require.NoError(err)
+	require.Len(data, 1)
+}
+
+func TestBoxPause(t *testing.T) {
+	require := require.New(t)
+
+	config := `
+	space[0].enabled = 1
+	space[0].index[0].type = "HASH"
+	space[0].index[0].unique = 1
+	space[0].index[0].key_field[0].fieldno = 0
+	space[0].index[0].key_field[0].type = "NUM"
+    `
+
+	box, err := NewBox(config)
+	require.NoError(err)
+	defer box.Close()
+	box.LogOnFailure(t)
+
+	conn, err := Connect(box.Listen(), &Options{QueryTimeout: 100 * time.Millisecond})
+	require.NoError(err)
+	defer conn.Close()
+
+	require.NoError(box.Pause())
+	_, err = conn.Execute(&Select{Space: 0, Value: PackInt(1)})
+	require.Equal(ErrResponseTimeout, err)
+
+	require.NoError(box.Resume())
+	_, err = conn.Execute(&Select{Space: 0, Value: PackInt(1)})
+	require.NoError(err)
+}
+
+func TestBoxLogRing(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newLogRing(8)
+	r.Write([]byte("hello"))
+	assert.Equal("hello", r.String())
+
+	offset := r.Written()
+	r.Write([]byte(" world"))
+	assert.Equal("lo world", r.String())
+	assert.Equal(" world", r.Since(offset))
+
+	r.Write([]byte("0123456789"))
+	assert.Equal("23456789", r.String())
+	assert.Equal("23456789", r.Since(offset))
+	assert.Equal(int64(21), r.Written())
+}
+
+// fakeBoxBinary writes shell script used instead of tarantool_box.
+func fakeBoxBinary(t *testing.T, script string) string {
+	binary := filepath.Join(t.TempDir(), "tarantool_box")
+	err := ioutil.WriteFile(binary, []byte("#!/bin/sh\n[ \"$3\" = \"--init-storage\" ] && exit 0\n"+script), 0755)
+	require.NoError(t, err)
+	return binary
+}
+
+func TestBoxStartTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	binary := fakeBoxBinary(t, "echo 'hanging on' >&2\nexec sleep 10\n")
+
+	started := time.Now()
+	_, err := NewBox("", BoxOptions{Binary: binary, StartTimeout: 100 * time.Millisecond})
+	assert.Error(err)
+	assert.Contains(err.Error(), "box hasn't started in 100ms")
+	assert.Contains(err.Error(), "hanging on")
+	assert.True(time.Since(started) < 5*time.Second)
+}
+
+func TestBoxStartExited(t *testing.T) {
+	assert := assert.New(t)
+
+	binary := fakeBoxBinary(t, "echo 'bad config' >&2\nexit 1\n")
+
+	_, err := NewBox("", BoxOptions{Binary: binary})
+	assert.Error(err)
+	assert.Contains(err.Error(), "box has exited while starting")
+	assert.Contains(err.Error(), "bad config")
+}
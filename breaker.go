@@ -0,0 +1,261 @@
+package tnt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen means query has not been sent as CircuitBreaker is open.
+var ErrCircuitOpen = NewConnectionError("Circuit breaker is open")
+
+// CircuitState is the state of CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed passes queries and counts failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails queries with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen passes single probe, which closes or opens the circuit.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// circuitBuckets is the number of buckets of CircuitBreaker.Window.
+const circuitBuckets = 10
+
+type circuitBucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// CircuitBreaker fails queries fast while the box fails or doesn't reply, see Options.CircuitBreaker.
+// Its state is shared by all the connections having the same *CircuitBreaker in options,
+// so it should be one per box. Zero value is ready to use with default settings.
+type CircuitBreaker struct {
+	// Window is the period failures are counted over, 10s by default.
+	Window time.Duration
+	// MinQueries is the number of queries in Window needed to open the circuit, 20 by default.
+	MinQueries int
+	// FailureRate is the share of failed queries in Window which opens the circuit, 0.5 by default.
+	FailureRate float64
+	// OpenTimeout is the time the circuit stays open before the probe, 1s by default.
+	OpenTimeout time.Duration
+	// Probe is the query sent to check the box in half-open state, e.g. &Ping{}.
+	// Nil means the first query after OpenTimeout is the probe.
+	Probe Query
+	// IsFailure decides whether the error counts as failure, IsTransient by default.
+	// So errors of the box itself, e.g. duplicate key, don't open the circuit.
+	IsFailure func(err error) bool
+	// Name is passed to OnStateChange to tell breakers apart, e.g. the box address.
+	// ReplicaSet sets it to the address of the box for its copy of the breaker.
+	Name string
+	// OnStateChange is called after every change of state. It must not block.
+	OnStateChange func(name string, from CircuitState, to CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	openedAt time.Time
+	probing  bool
+	buckets  [circuitBuckets]circuitBucket
+}
+
+// clone returns breaker with the same settings, the given name and closed circuit.
+func (cb *CircuitBreaker) clone(name string) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:          name,
+		Window:        cb.Window,
+		MinQueries:    cb.MinQueries,
+		FailureRate:   cb.FailureRate,
+		OpenTimeout:   cb.OpenTimeout,
+		Probe:         cb.Probe,
+		IsFailure:     cb.IsFailure,
+		OnStateChange: cb.OnStateChange,
+	}
+}
+
+func (cb *CircuitBreaker) window() time.Duration {
+	if cb.Window > 0 {
+		return cb.Window
+	}
+	return 10 * time.Second
+}
+
+func (cb *CircuitBreaker) minQueries() int {
+	if cb.MinQueries > 0 {
+		return cb.MinQueries
+	}
+	return 20
+}
+
+func (cb *CircuitBreaker) failureRate() float64 {
+	if cb.FailureRate > 0 {
+		return cb.FailureRate
+	}
+	return 0.5
+}
+
+func (cb *CircuitBreaker) openTimeout() time.Duration {
+	if cb.OpenTimeout > 0 {
+		return cb.OpenTimeout
+	}
+	return time.Second
+}
+
+func (cb *CircuitBreaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if cb.IsFailure != nil {
+		return cb.IsFailure(err)
+	}
+	return IsTransient(err)
+}
+
+// State returns the current state. Open circuit becomes half-open on the next query after OpenTimeout.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// setState must be called with mu locked, it returns the callback of change.
+func (cb *CircuitBreaker) setState(state CircuitState, now time.Time) func() {
+	from := cb.state
+	if from == state {
+		return func() {}
+	}
+
+	cb.state = state
+	switch state {
+	case CircuitOpen:
+		cb.openedAt = now
+	case CircuitClosed:
+		cb.buckets = [circuitBuckets]circuitBucket{}
+	}
+
+	if cb.OnStateChange == nil {
+		return func() {}
+	}
+	return func() { cb.OnStateChange(cb.Name, from, state) }
+}
+
+// allow returns true if query may be sent and whether it is the probe.
+func (cb *CircuitBreaker) allow(now time.Time) (allowed bool, probe bool, changed func()) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitClosed:
+		return true, false, func() {}
+	case CircuitOpen:
+		if now.Sub(cb.openedAt) < cb.openTimeout() {
+			return false, false, func() {}
+		}
+		changed = cb.setState(CircuitHalfOpen, now)
+	default:
+		changed = func() {}
+	}
+
+	if cb.probing {
+		return false, false, changed
+	}
+	cb.probing = true
+	return true, true, changed
+}
+
+// record counts result of the query in closed state or applies result of the probe.
+func (cb *CircuitBreaker) record(now time.Time, probe bool, failed bool) func() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe {
+		cb.probing = false
+		if failed {
+			return cb.setState(CircuitOpen, now)
+		}
+		return cb.setState(CircuitClosed, now)
+	}
+
+	if cb.state != CircuitClosed {
+		return func() {}
+	}
+
+	bucketSize := cb.window() / circuitBuckets
+	start := now.Truncate(bucketSize)
+	b := &cb.buckets[start.UnixNano()/int64(bucketSize)%circuitBuckets]
+	if !b.start.Equal(start) {
+		*b = circuitBucket{start: start}
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+
+	total, failures := 0, 0
+	for _, b := range cb.buckets {
+		if now.Sub(b.start) < cb.window() {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	if total >= cb.minQueries() && float64(failures) >= cb.failureRate()*float64(total) {
+		return cb.setState(CircuitOpen, now)
+	}
+	return func() {}
+}
+
+// abortProbe lets the next query probe, the circuit stays half-open.
+func (cb *CircuitBreaker) abortProbe() {
+	cb.mu.Lock()
+	cb.probing = false
+	cb.mu.Unlock()
+}
+
+// Interceptor returns interceptor which fails queries with ErrCircuitOpen while the circuit is open.
+// Options.CircuitBreaker puts it after Options.Retry, so every attempt is counted.
+func (cb *CircuitBreaker) Interceptor() Interceptor {
+	return func(ctx context.Context, q Query, next Invoker) ([]Tuple, error) {
+		allowed, probe, changed := cb.allow(time.Now())
+		changed()
+		if !allowed {
+			return nil, ErrCircuitOpen
+		}
+
+		// probe interrupted by the caller's context tells nothing about the box
+		if probe && cb.Probe != nil {
+			_, err := next(ctx, cb.Probe)
+			if ctx.Err() != nil {
+				cb.abortProbe()
+				return nil, err
+			}
+			failed := cb.isFailure(err)
+			cb.record(time.Now(), true, failed)()
+			if failed {
+				return nil, ErrCircuitOpen
+			}
+			probe = false
+		}
+
+		result, err := next(ctx, q)
+		if probe && ctx.Err() != nil {
+			cb.abortProbe()
+			return result, err
+		}
+		cb.record(time.Now(), probe, cb.isFailure(err))()
+		return result, err
+	}
+}
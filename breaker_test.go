@@ -0,0 +1,194 @@
+package tnt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var changes []string
+	cb := &CircuitBreaker{
+		MinQueries:  4,
+		OpenTimeout: 50 * time.Millisecond,
+		Probe:       &Ping{},
+		OnStateChange: func(name string, from CircuitState, to CircuitState) {
+			mu.Lock()
+			changes = append(changes, fmt.Sprintf("%s->%s", from, to))
+			mu.Unlock()
+		},
+	}
+	intercept := cb.Interceptor()
+
+	var calls []string
+	var failWith error
+	next := func(ctx context.Context, q Query) ([]Tuple, error) {
+		calls = append(calls, fmt.Sprintf("%T", q))
+		return nil, failWith
+	}
+	exec := func() error {
+		_, err := intercept(context.Background(), &Select{}, next)
+		return err
+	}
+
+	// errors of the box are not failures
+	failWith = NewQueryErrorCode(ErrCodeTupleFound, "Duplicate key exists in unique index 0")
+	for i := 0; i < 4; i++ {
+		assert.Equal(failWith, exec())
+	}
+	assert.Equal(CircuitClosed, cb.State())
+
+	failWith = ErrResponseTimeout
+	for i := 0; i < 4; i++ {
+		assert.Equal(ErrResponseTimeout, exec())
+	}
+	assert.Equal(CircuitOpen, cb.State())
+	assert.Len(calls, 8)
+
+	// open circuit doesn't pass queries
+	assert.Equal(ErrCircuitOpen, exec())
+	assert.Len(calls, 8)
+
+	// failed probe opens it again
+	calls = nil
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(ErrCircuitOpen, exec())
+	assert.Equal([]string{"*tnt.Ping"}, calls)
+	assert.Equal(CircuitOpen, cb.State())
+
+	calls = nil
+	failWith = nil
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(exec())
+	assert.Equal([]string{"*tnt.Ping", "*tnt.Select"}, calls)
+	assert.Equal(CircuitClosed, cb.State())
+
+	mu.Lock()
+	assert.Equal([]string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}, changes)
+	mu.Unlock()
+}
+
+func TestCircuitBreakerCanceledProbe(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, probe := range []Query{&Ping{}, nil} {
+		cb := &CircuitBreaker{MinQueries: 1, OpenTimeout: 10 * time.Millisecond, Probe: probe}
+		intercept := cb.Interceptor()
+
+		failing := func(ctx context.Context, q Query) ([]Tuple, error) {
+			return nil, ErrResponseTimeout
+		}
+		_, err := intercept(context.Background(), &Select{}, failing)
+		assert.Equal(ErrResponseTimeout, err)
+		assert.Equal(CircuitOpen, cb.State())
+		time.Sleep(20 * time.Millisecond)
+
+		// probe canceled by the caller neither closes nor opens the circuit
+		ctx, cancel := context.WithCancel(context.Background())
+		canceling := func(ctx context.Context, q Query) ([]Tuple, error) {
+			cancel()
+			return nil, context.Canceled
+		}
+		_, err = intercept(ctx, &Select{}, canceling)
+		assert.Equal(context.Canceled, err)
+		assert.Equal(CircuitHalfOpen, cb.State(), "probe %T", probe)
+
+		// the next query probes
+		ok := func(ctx context.Context, q Query) ([]Tuple, error) {
+			return []Tuple{}, nil
+		}
+		_, err = intercept(context.Background(), &Select{}, ok)
+		assert.NoError(err)
+		assert.Equal(CircuitClosed, cb.State(), "probe %T", probe)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	assert := assert.New(t)
+
+	cb := &CircuitBreaker{MinQueries: 1, OpenTimeout: time.Millisecond}
+	intercept := cb.Interceptor()
+
+	_, err := intercept(context.Background(), &Select{}, func(ctx context.Context, q Query) ([]Tuple, error) {
+		return nil, ErrConnectionClosed
+	})
+	assert.True(errors.Is(err, ErrConnectionClosed))
+	assert.Equal(CircuitOpen, cb.State())
+	time.Sleep(5 * time.Millisecond)
+
+	// the first query is the probe, others fail while it is in flight
+	started := make(chan bool)
+	release := make(chan bool)
+	done := make(chan error)
+	go func() {
+		_, err := intercept(context.Background(), &Select{}, func(ctx context.Context, q Query) ([]Tuple, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+		done <- err
+	}()
+
+	<-started
+	assert.Equal(CircuitHalfOpen, cb.State())
+	_, err = intercept(context.Background(), &Select{}, func(ctx context.Context, q Query) ([]Tuple, error) {
+		return nil, nil
+	})
+	assert.Equal(ErrCircuitOpen, err)
+
+	close(release)
+	assert.NoError(<-done)
+	assert.Equal(CircuitClosed, cb.State())
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	cb := &CircuitBreaker{Window: 100 * time.Millisecond, MinQueries: 2}
+	now := time.Now()
+
+	// failures out of window are forgotten
+	cb.record(now, false, true)
+	cb.record(now.Add(150*time.Millisecond), false, false)
+	assert.Equal(CircuitClosed, cb.State())
+
+	cb.record(now.Add(160*time.Millisecond), false, true)
+	assert.Equal(CircuitOpen, cb.State())
+}
+
+func TestConnectorCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	cb := &CircuitBreaker{MinQueries: 2, OpenTimeout: time.Hour}
+	connector := New(addr, &Options{CircuitBreaker: cb, Retry: &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}})
+	defer connector.Close()
+
+	// dial errors are failures, the last retry fails fast and isn't retried further
+	_, err = connector.Execute(&Ping{})
+	var retryErr *RetryError
+	if assert.True(errors.As(err, &retryErr)) {
+		assert.Equal(3, retryErr.Attempts)
+	}
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	assert.Equal(CircuitOpen, cb.State())
+
+	// connections with the same breaker share its state
+	_, err = New(addr, &Options{CircuitBreaker: cb}).Execute(&Ping{})
+	assert.Equal(ErrCircuitOpen, err)
+}
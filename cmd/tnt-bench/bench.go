@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// execFunc runs query on behalf of worker.
+type execFunc func(ctx context.Context, worker int, q tnt.Query) error
+
+type benchConfig struct {
+	workload    *workload
+	concurrency int
+	// rate is the target of requests per second for all workers, 0 means as fast as possible.
+	rate     float64
+	duration time.Duration
+	// warmup is the time in the beginning of run which is not recorded.
+	warmup  time.Duration
+	timeout time.Duration
+	// progress is called every second with the number of queries done.
+	progress func(elapsed time.Duration, done int64, errors int64)
+}
+
+// workerStats is owned by worker until it exits.
+type workerStats struct {
+	latency [numOps]*histogram
+	errors  [numOps]int64
+	samples map[string]int64
+}
+
+const maxErrorSamples = 10
+
+func newWorkerStats() *workerStats {
+	s := &workerStats{samples: make(map[string]int64)}
+	for op := range s.latency {
+		s.latency[op] = newHistogram()
+	}
+	return s
+}
+
+func (s *workerStats) merge(other *workerStats) {
+	for op := range s.latency {
+		s.latency[op].Merge(other.latency[op])
+		s.errors[op] += other.errors[op]
+	}
+	for msg, count := range other.samples {
+		if _, ok := s.samples[msg]; ok || len(s.samples) < maxErrorSamples {
+			s.samples[msg] += count
+		}
+	}
+}
+
+// runBench runs workload and returns stats of queries started after warmup and the measured time.
+// With rate latency is counted from the time query was scheduled at rather than sent at,
+// so stalls of the box are not hidden by workers waiting for replies (coordinated omission).
+func runBench(ctx context.Context, config *benchConfig, exec execFunc) (*workerStats, time.Duration) {
+	start := time.Now()
+	measureFrom := start.Add(config.warmup)
+	end := measureFrom.Add(config.duration)
+
+	ctx, cancel := context.WithDeadline(ctx, end)
+	defer cancel()
+
+	var done, failed int64
+
+	var schedule chan time.Time
+	if config.rate > 0 {
+		schedule = make(chan time.Time, config.concurrency)
+		go runSchedule(ctx, config.rate, start, end, schedule)
+	}
+
+	stats := make([]*workerStats, config.concurrency)
+	var wg sync.WaitGroup
+	for w := 0; w < config.concurrency; w++ {
+		stats[w] = newWorkerStats()
+		wg.Add(1)
+		go func(w int, s *workerStats) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(w)))
+
+			for ctx.Err() == nil {
+				var scheduled time.Time
+				if schedule != nil {
+					var ok bool
+					if scheduled, ok = <-schedule; !ok {
+						return
+					}
+				} else {
+					scheduled = time.Now()
+				}
+
+				op := config.workload.mix.pick(rnd)
+				q := config.workload.query(op, rnd)
+
+				qctx, qcancel := context.WithTimeout(context.Background(), config.timeout)
+				err := exec(qctx, w, q)
+				qcancel()
+				finished := time.Now()
+
+				atomic.AddInt64(&done, 1)
+				if err != nil {
+					atomic.AddInt64(&failed, 1)
+				}
+				if scheduled.Before(measureFrom) || finished.After(end) {
+					continue
+				}
+
+				if err != nil {
+					s.errors[op]++
+					msg := err.Error()
+					if _, ok := s.samples[msg]; ok || len(s.samples) < maxErrorSamples {
+						s.samples[msg]++
+					}
+					continue
+				}
+				s.latency[op].Record(finished.Sub(scheduled))
+			}
+		}(w, stats[w])
+	}
+
+	workersDone := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+
+	if config.progress != nil {
+		ticker := time.NewTicker(time.Second)
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				config.progress(time.Since(start), atomic.LoadInt64(&done), atomic.LoadInt64(&failed))
+			case <-workersDone:
+				break loop
+			}
+		}
+		ticker.Stop()
+	}
+	<-workersDone
+
+	total := newWorkerStats()
+	for _, s := range stats {
+		total.merge(s)
+	}
+
+	elapsed := time.Since(measureFrom)
+	if elapsed > config.duration {
+		elapsed = config.duration
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return total, elapsed
+}
+
+// runSchedule sends times queries must be started at evenly with rate.
+// If workers fall behind, the backlog is sent as soon as they are free with the original times.
+func runSchedule(ctx context.Context, rate float64, start, end time.Time, schedule chan<- time.Time) {
+	defer close(schedule)
+
+	interval := time.Duration(float64(time.Second) / rate)
+	tick := interval
+	if tick > time.Millisecond {
+		tick = time.Millisecond
+	}
+
+	var sent int64
+	for {
+		now := time.Now()
+		due := int64(now.Sub(start).Seconds()*rate) + 1
+		for ; sent < due; sent++ {
+			scheduled := start.Add(time.Duration(float64(sent) * float64(time.Second) / rate))
+			if !scheduled.Before(end) {
+				return
+			}
+			select {
+			case schedule <- scheduled:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-time.After(tick):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
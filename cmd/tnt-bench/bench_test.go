@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMix(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := parseMix("select=80, insert=15,update=5")
+	assert.NoError(err)
+	assert.Equal(mix{80, 15, 5, 0}, m)
+	assert.Equal("select=80,insert=15,update=5", m.String())
+
+	for _, s := range []string{"", "select", "scan=1", "select=-1", "select=0"} {
+		_, err := parseMix(s)
+		assert.Error(err, s)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	var counts [numOps]int
+	for i := 0; i < 10000; i++ {
+		counts[m.pick(rnd)]++
+	}
+	assert.InDelta(8000, counts[opSelect], 300)
+	assert.InDelta(500, counts[opUpdate], 150)
+	assert.Equal(0, counts[opCall])
+}
+
+func TestWorkload(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &workload{mix: mix{1, 1, 1, 1}, keys: 10, keyType: tnt.Num64, valueSize: 3}
+	assert.Error(w.validate())
+	w.proc = "box.select"
+	assert.NoError(w.validate())
+
+	rnd := rand.New(rand.NewSource(1))
+	q := w.query(opInsert, rnd).(*tnt.Insert)
+	assert.Len(q.Tuple[0], 8)
+	assert.Len(q.Tuple[1], 3)
+	assert.True(tnt.UnpackLong(q.Tuple[0]) < 10)
+
+	w.keyType = tnt.Num
+	w.keys = 1<<32 + 1
+	assert.Error(w.validate())
+}
+
+func TestRunBench(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &benchConfig{
+		workload:    &workload{mix: mix{1, 1, 0, 0}, keys: 100, keyType: tnt.Num},
+		concurrency: 4,
+		duration:    200 * time.Millisecond,
+		warmup:      50 * time.Millisecond,
+		timeout:     time.Second,
+	}
+
+	errFailed := errors.New("insert failed")
+	exec := func(ctx context.Context, worker int, q tnt.Query) error {
+		time.Sleep(time.Millisecond)
+		if _, ok := q.(*tnt.Insert); ok {
+			return errFailed
+		}
+		return nil
+	}
+
+	stats, elapsed := runBench(context.Background(), config, exec)
+	assert.Equal(config.duration, elapsed)
+	assert.True(stats.latency[opSelect].Count() > 0)
+	assert.True(stats.latency[opSelect].Min() >= time.Millisecond)
+	assert.Equal(int64(0), stats.latency[opInsert].Count())
+	assert.True(stats.errors[opInsert] > 0)
+	assert.Equal(stats.errors[opInsert], stats.samples["insert failed"])
+
+	r := newReport(stats, elapsed)
+	assert.Equal(stats.latency[opSelect].Count(), r.Total.Count)
+	assert.Equal(stats.errors[opInsert], r.Total.Errors)
+	_, err := json.Marshal(r)
+	assert.NoError(err)
+
+	var buf bytes.Buffer
+	assert.NoError(r.writeText(&buf))
+	assert.Contains(buf.String(), "select")
+	assert.Contains(buf.String(), "insert failed")
+}
+
+func TestRunBenchRate(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &benchConfig{
+		workload:    &workload{mix: mix{1, 0, 0, 0}, keys: 100, keyType: tnt.Num},
+		concurrency: 4,
+		rate:        1000,
+		duration:    500 * time.Millisecond,
+		timeout:     time.Second,
+	}
+
+	// a stall makes all the workers busy, so queries scheduled meanwhile wait
+	// and their latency is counted from the schedule
+	stalled := make(chan bool)
+	time.AfterFunc(100*time.Millisecond, func() { close(stalled) })
+	exec := func(ctx context.Context, worker int, q tnt.Query) error {
+		<-stalled
+		return nil
+	}
+
+	stats, _ := runBench(context.Background(), config, exec)
+	h := stats.latency[opSelect]
+	assert.InDelta(500, h.Count(), 50)
+	assert.True(h.Max() >= 90*time.Millisecond, "max %s", h.Max())
+	// queries scheduled after the stall are not delayed
+	assert.True(h.Quantile(0.5) < 10*time.Millisecond, "p50 %s", h.Quantile(0.5))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histogramPrecision is the number of mantissa bits, values are recorded with relative error under 2^-(precision-1).
+const histogramPrecision = 8
+
+// histogram is HDR-style log-linear histogram of durations. It is not safe for concurrent use,
+// every worker records its own histograms which are merged into the report.
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+func newHistogram() *histogram {
+	const sub = 1 << histogramPrecision
+	return &histogram{
+		counts: make([]int64, sub+(64-histogramPrecision)*sub/2),
+		min:    math.MaxInt64,
+	}
+}
+
+// bucket returns index of v: values under 2^precision are exact, larger ones are grouped by
+// their top precision bits, so every power of two range has 2^(precision-1) buckets.
+func bucket(v uint64) int {
+	const sub = 1 << histogramPrecision
+	if v < sub {
+		return int(v)
+	}
+	e := bits.Len64(v) - histogramPrecision
+	mantissa := v >> uint(e)
+	return sub + (e-1)*sub/2 + int(mantissa-sub/2)
+}
+
+// bucketValue returns the highest value of bucket i.
+func bucketValue(i int) uint64 {
+	const sub = 1 << histogramPrecision
+	if i < sub {
+		return uint64(i)
+	}
+	e := (i-sub)/(sub/2) + 1
+	mantissa := uint64((i-sub)%(sub/2) + sub/2)
+	return (mantissa+1)<<uint(e) - 1
+}
+
+func (h *histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	h.counts[bucket(uint64(v))]++
+	h.count++
+	h.sum += v
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *histogram) Merge(other *histogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.count += other.count
+	h.sum += other.sum
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+func (h *histogram) Count() int64 {
+	return h.count
+}
+
+func (h *histogram) Min() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+func (h *histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / h.count)
+}
+
+// Quantile returns the value q*Count() recorded values are less or equal to, q is in [0, 1].
+func (h *histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := int64(bucketValue(i))
+			// the bucket upper bound may be beyond any recorded value
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
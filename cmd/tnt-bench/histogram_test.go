@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	prev := -1
+	for _, v := range []uint64{0, 1, 255, 256, 257, 511, 512, 1000, 1 << 20, 1<<63 - 1, 1<<64 - 1} {
+		i := bucket(v)
+		assert.True(i >= prev, "bucket of %d", v)
+		assert.True(i < len(newHistogram().counts), "bucket of %d", v)
+		assert.True(bucketValue(i) >= v, "upper bound of %d", v)
+		// relative error is bounded by precision
+		assert.True(float64(bucketValue(i)-v) <= float64(v)/(1<<(histogramPrecision-1)), "error of %d", v)
+		prev = i
+	}
+
+	for i := 1; i < len(newHistogram().counts); i++ {
+		assert.Equal(i, bucket(bucketValue(i)), "bucket %d", i)
+		assert.Equal(i, bucket(bucketValue(i-1)+1), "bucket %d", i)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	assert := assert.New(t)
+
+	h := newHistogram()
+	assert.Equal(time.Duration(0), h.Quantile(0.5))
+
+	values := make([]time.Duration, 100000)
+	for i := range values {
+		values[i] = time.Duration(rand.ExpFloat64() * float64(time.Millisecond))
+	}
+
+	// merged histograms are the same as single one
+	other := newHistogram()
+	for i, v := range values {
+		if i%2 == 0 {
+			h.Record(v)
+		} else {
+			other.Record(v)
+		}
+	}
+	h.Merge(other)
+	assert.Equal(int64(len(values)), h.Count())
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	assert.Equal(values[0], h.Min())
+	assert.Equal(values[len(values)-1], h.Max())
+	assert.Equal(values[len(values)-1], h.Quantile(1))
+
+	for _, q := range []float64{0.5, 0.99, 0.999} {
+		exact := values[int(q*float64(len(values)))-1]
+		got := h.Quantile(q)
+		assert.InEpsilon(float64(exact), float64(got), 0.01, "q%v", q)
+	}
+}
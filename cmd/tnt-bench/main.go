@@ -0,0 +1,249 @@
+// Command tnt-bench generates load of select/insert/update/call mix against tarantool 1.5 box
+// and reports throughput and latency percentiles.
+//
+// Usage:
+//
+//	tnt-bench [flags] host:port/space
+//
+// The space is expected to have tuples {key, value} with primary index on the key.
+// Without -rate every worker sends next query as soon as the previous one is replied,
+// with -rate queries are sent on schedule and latency includes the time they waited for a free worker.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// latencyReport is in microseconds.
+type latencyReport struct {
+	Min  float64 `json:"min_us"`
+	Mean float64 `json:"mean_us"`
+	P50  float64 `json:"p50_us"`
+	P90  float64 `json:"p90_us"`
+	P99  float64 `json:"p99_us"`
+	P999 float64 `json:"p999_us"`
+	Max  float64 `json:"max_us"`
+}
+
+type opReport struct {
+	Count      int64         `json:"count"`
+	Errors     int64         `json:"errors"`
+	Throughput float64       `json:"throughput"`
+	Latency    latencyReport `json:"latency"`
+}
+
+type report struct {
+	Addr        string               `json:"addr"`
+	Mix         string               `json:"mix"`
+	Conns       int                  `json:"conns"`
+	Concurrency int                  `json:"concurrency"`
+	Rate        float64              `json:"rate"`
+	Duration    float64              `json:"duration_s"`
+	Ops         map[string]*opReport `json:"ops"`
+	Total       *opReport            `json:"total"`
+	ErrorSample map[string]int64     `json:"error_sample,omitempty"`
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+func newOpReport(h *histogram, errors int64, elapsed time.Duration) *opReport {
+	var throughput float64
+	if elapsed > 0 {
+		throughput = float64(h.Count()) / elapsed.Seconds()
+	}
+	return &opReport{
+		Count:      h.Count(),
+		Errors:     errors,
+		Throughput: throughput,
+		Latency: latencyReport{
+			Min:  micros(h.Min()),
+			Mean: micros(h.Mean()),
+			P50:  micros(h.Quantile(0.5)),
+			P90:  micros(h.Quantile(0.9)),
+			P99:  micros(h.Quantile(0.99)),
+			P999: micros(h.Quantile(0.999)),
+			Max:  micros(h.Max()),
+		},
+	}
+}
+
+func newReport(stats *workerStats, elapsed time.Duration) *report {
+	r := &report{
+		Duration:    elapsed.Seconds(),
+		Ops:         make(map[string]*opReport),
+		ErrorSample: stats.samples,
+	}
+
+	total := newHistogram()
+	var totalErrors int64
+	for op := opType(0); op < numOps; op++ {
+		h := stats.latency[op]
+		if h.Count() == 0 && stats.errors[op] == 0 {
+			continue
+		}
+		r.Ops[op.String()] = newOpReport(h, stats.errors[op], elapsed)
+		total.Merge(h)
+		totalErrors += stats.errors[op]
+	}
+	r.Total = newOpReport(total, totalErrors, elapsed)
+	return r
+}
+
+func (r *report) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "%s mix=%s conns=%d concurrency=%d rate=%v duration=%.1fs\n\n",
+		r.Addr, r.Mix, r.Conns, r.Concurrency, r.Rate, r.Duration)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcount\terrors\tops/s\tmean\tp50\tp90\tp99\tp999\tmax\t")
+
+	names := make([]string, 0, len(r.Ops))
+	for name := range r.Ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	row := func(name string, op *opReport) {
+		l := op.Latency
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f\t%s\t%s\t%s\t%s\t%s\t%s\t\n", name, op.Count, op.Errors, op.Throughput,
+			usString(l.Mean), usString(l.P50), usString(l.P90), usString(l.P99), usString(l.P999), usString(l.Max))
+	}
+	for _, name := range names {
+		row(name, r.Ops[name])
+	}
+	row("total", r.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.ErrorSample) != 0 {
+		fmt.Fprintln(w, "\nerrors:")
+		for msg, count := range r.ErrorSample {
+			fmt.Fprintf(w, "%8d %s\n", count, msg)
+		}
+	}
+	return nil
+}
+
+func usString(us float64) string {
+	return time.Duration(us * float64(time.Microsecond)).Round(time.Microsecond).String()
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("tnt-bench", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	mixFlag := flags.String("mix", "select=100", "weights of select, insert, update and call ops")
+	conns := flags.Int("conns", 1, "number of connections, workers are spread over them")
+	concurrency := flags.Int("concurrency", 64, "number of workers, i.e. max queries in flight")
+	rate := flags.Float64("rate", 0, "target queries per second, 0 means as fast as possible")
+	duration := flags.Duration("duration", 10*time.Second, "measured run time")
+	warmup := flags.Duration("warmup", 0, "run time before measurement")
+	timeout := flags.Duration("timeout", time.Second, "query timeout")
+	keys := flags.Uint64("keys", 100000, "number of distinct keys")
+	keyType := flags.String("key-type", "NUM", "key field type: NUM, NUM64 or STR")
+	valueSize := flags.Int("value-size", 64, "size of value field of insert and update")
+	proc := flags.String("proc", "", "lua procedure for call op, it gets the key")
+	jsonOutput := flags.Bool("json", false, "write report as JSON")
+	quiet := flags.Bool("quiet", false, "don't report progress every second")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("Usage: tnt-bench [flags] host:port/space")
+	}
+	addr := flags.Arg(0)
+
+	m, err := parseMix(*mixFlag)
+	if err != nil {
+		return err
+	}
+
+	w := &workload{
+		mix:       m,
+		keys:      *keys,
+		keyType:   tnt.FieldType(*keyType),
+		valueSize: *valueSize,
+		proc:      *proc,
+	}
+	if err := w.validate(); err != nil {
+		return err
+	}
+	if *conns <= 0 || *concurrency <= 0 {
+		return errors.New("conns and concurrency must be positive")
+	}
+
+	connectors := make([]*tnt.Connector, *conns)
+	for i := range connectors {
+		connectors[i] = tnt.New(addr, &tnt.Options{ConnectTimeout: *timeout, QueryTimeout: *timeout})
+		// fail fast if the box is unreachable
+		if _, err := connectors[i].Connect(); err != nil {
+			return err
+		}
+		defer connectors[i].Close()
+	}
+
+	exec := func(ctx context.Context, worker int, q tnt.Query) error {
+		conn, err := connectors[worker%len(connectors)].Connect()
+		if err != nil {
+			return err
+		}
+		_, err = conn.Exec(ctx, q)
+		return err
+	}
+
+	config := &benchConfig{
+		workload:    w,
+		concurrency: *concurrency,
+		rate:        *rate,
+		duration:    *duration,
+		warmup:      *warmup,
+		timeout:     *timeout,
+	}
+	if !*quiet {
+		config.progress = func(elapsed time.Duration, done int64, failed int64) {
+			fmt.Fprintf(stderr, "%s: %d queries, %d errors, %.0f q/s\n",
+				elapsed.Truncate(time.Second), done, failed, float64(done)/elapsed.Seconds())
+		}
+	}
+
+	// interrupted run is reported as well
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	stats, elapsed := runBench(ctx, config, exec)
+
+	r := newReport(stats, elapsed)
+	r.Addr = addr
+	r.Mix = m.String()
+	r.Conns = *conns
+	r.Concurrency = *concurrency
+	r.Rate = *rate
+
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return r.writeText(stdout)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+type opType int
+
+const (
+	opSelect opType = iota
+	opInsert
+	opUpdate
+	opCall
+	numOps
+)
+
+var opNames = [numOps]string{"select", "insert", "update", "call"}
+
+func (op opType) String() string {
+	return opNames[op]
+}
+
+// mix is the weights of operations.
+type mix [numOps]int
+
+// parseMix parses "select=80,insert=15,update=5".
+func parseMix(s string) (mix, error) {
+	var m mix
+	total := 0
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return m, fmt.Errorf("wrong mix item %q: op=weight expected", item)
+		}
+
+		op := opType(-1)
+		for i, name := range opNames {
+			if kv[0] == name {
+				op = opType(i)
+			}
+		}
+		if op < 0 {
+			return m, fmt.Errorf("unknown op %q in mix", kv[0])
+		}
+
+		weight, err := strconv.ParseUint(kv[1], 10, 31)
+		if err != nil {
+			return m, fmt.Errorf("wrong weight of %s: %s", kv[0], err)
+		}
+		m[op] += int(weight)
+		total += int(weight)
+	}
+	if total == 0 {
+		return m, fmt.Errorf("mix %q is empty", s)
+	}
+	return m, nil
+}
+
+func (m mix) String() string {
+	var items []string
+	for op, weight := range m {
+		if weight != 0 {
+			items = append(items, fmt.Sprintf("%s=%d", opType(op), weight))
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// pick returns random op by weights.
+func (m mix) pick(rnd *rand.Rand) opType {
+	total := 0
+	for _, weight := range m {
+		total += weight
+	}
+	n := rnd.Intn(total)
+	for op, weight := range m {
+		if n < weight {
+			return opType(op)
+		}
+		n -= weight
+	}
+	panic("unreachable")
+}
+
+// workload makes queries over tuples {key, value} with uniformly distributed keys.
+type workload struct {
+	mix       mix
+	keys      uint64
+	keyType   tnt.FieldType
+	valueSize int
+	proc      string
+}
+
+func (w *workload) validate() error {
+	if w.keys == 0 {
+		return fmt.Errorf("keys must be positive")
+	}
+	switch w.keyType {
+	case tnt.Num, tnt.Num64, tnt.Str:
+		// pass
+	default:
+		return fmt.Errorf("unknown key type %q", w.keyType)
+	}
+	if w.keyType == tnt.Num && w.keys > 1<<32 {
+		return fmt.Errorf("%d keys don't fit NUM", w.keys)
+	}
+	if w.mix[opCall] != 0 && w.proc == "" {
+		return fmt.Errorf("call needs procedure name")
+	}
+	return nil
+}
+
+func (w *workload) key(rnd *rand.Rand) tnt.Bytes {
+	k := uint64(rnd.Int63n(int64(w.keys)))
+	switch w.keyType {
+	case tnt.Num:
+		return tnt.PackInt(uint32(k))
+	case tnt.Num64:
+		return tnt.PackLong(k)
+	default:
+		return tnt.Bytes(strconv.FormatUint(k, 10))
+	}
+}
+
+func (w *workload) value(rnd *rand.Rand) tnt.Bytes {
+	value := make(tnt.Bytes, w.valueSize)
+	for i := range value {
+		value[i] = byte('a' + rnd.Intn(26))
+	}
+	return value
+}
+
+func (w *workload) query(op opType, rnd *rand.Rand) tnt.Query {
+	key := w.key(rnd)
+	switch op {
+	case opSelect:
+		return &tnt.Select{Value: key, Limit: 1}
+	case opInsert:
+		return &tnt.Insert{Tuple: tnt.Tuple{key, w.value(rnd)}}
+	case opUpdate:
+		return &tnt.Update{Tuple: tnt.Tuple{key}, Ops: []tnt.Operator{tnt.OpSet(1, w.value(rnd))}}
+	default:
+		return &tnt.Call{Name: tnt.Bytes(w.proc), Tuple: tnt.Tuple{key}}
+	}
+}
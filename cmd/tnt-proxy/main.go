@@ -0,0 +1,128 @@
+// Command tnt-proxy accepts tarantool 1.5 iproto clients and forwards their requests
+// over a few connections to the boxes.
+//
+// Usage:
+//
+//	tnt-proxy [flags] upstream...
+//
+// With -route space every upstream is "host:port" for the default upstream or "space=host:port".
+// With -route key upstreams are "host:port" shards and requests are routed by crc32 of the first key field.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/lomik/go-tnt/proxy"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("tnt-proxy", flag.ContinueOnError)
+	listen := flags.String("listen", ":2001", "address to accept clients on")
+	route := flags.String("route", "space", "routing: space or key")
+	poolSize := flags.Int("pool-size", 4, "connections per upstream")
+	timeout := flags.Duration("timeout", time.Second, "upstream query timeout")
+	maxInFlight := flags.Int("max-in-flight", 256, "requests of a client forwarded at once")
+	maxRequestSize := flags.Int("max-request-size", 1<<20, "max request body in bytes, larger requests disconnect the client")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("Usage: tnt-proxy [flags] upstream...")
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	opts := &tnt.Options{
+		ConnectTimeout: *timeout,
+		QueryTimeout:   *timeout,
+		Logger:         logger,
+	}
+
+	var pools []*tnt.Pool
+	newPool := func(addr string) *tnt.Pool {
+		pool := tnt.NewPool(addr, *poolSize, opts)
+		pools = append(pools, pool)
+		return pool
+	}
+	defer func() {
+		for _, pool := range pools {
+			pool.Close()
+		}
+	}()
+
+	router, err := newRouter(*route, flags.Args(), newPool)
+	if err != nil {
+		return err
+	}
+
+	s := &proxy.Server{
+		Router:         router,
+		Timeout:        *timeout,
+		MaxInFlight:    *maxInFlight,
+		MaxRequestSize: *maxRequestSize,
+		Logger:         logger,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		s.Close()
+	}()
+
+	logger.Printf("tnt-proxy: listening on %s", *listen)
+	if err := s.ListenAndServe(*listen); err != proxy.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func newRouter(route string, upstreams []string, newPool func(addr string) *tnt.Pool) (proxy.Router, error) {
+	switch route {
+	case "space":
+		r := &proxy.SpaceRouter{Spaces: make(map[uint32]proxy.Upstream)}
+		for _, upstream := range upstreams {
+			i := strings.IndexByte(upstream, '=')
+			if i < 0 {
+				if r.Default != nil {
+					return nil, fmt.Errorf("default upstream is given twice: %s", upstream)
+				}
+				r.Default = newPool(upstream)
+				continue
+			}
+
+			space, err := strconv.ParseUint(upstream[:i], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Wrong space: %s", upstream[:i])
+			}
+			if _, ok := r.Spaces[uint32(space)]; ok {
+				return nil, fmt.Errorf("space %d is given twice", space)
+			}
+			r.Spaces[uint32(space)] = newPool(upstream[i+1:])
+		}
+		return r, nil
+	case "key":
+		r := &proxy.KeyRouter{}
+		for _, upstream := range upstreams {
+			r.Shards = append(r.Shards, newPool(upstream))
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("unknown route %q", route)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/lomik/go-tnt/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	var addrs []string
+	newPool := func(addr string) *tnt.Pool {
+		addrs = append(addrs, addr)
+		return tnt.NewPool(addr, 1, nil)
+	}
+
+	r, err := newRouter("space", []string{"a:1", "7=b:2", "8=c:3"}, newPool)
+	assert.NoError(err)
+	assert.Equal([]string{"a:1", "b:2", "c:3"}, addrs)
+	if assert.IsType(&proxy.SpaceRouter{}, r) {
+		assert.Len(r.(*proxy.SpaceRouter).Spaces, 2)
+		assert.NotNil(r.(*proxy.SpaceRouter).Default)
+	}
+
+	r, err = newRouter("key", []string{"a:1", "b:2"}, newPool)
+	assert.NoError(err)
+	if assert.IsType(&proxy.KeyRouter{}, r) {
+		assert.Len(r.(*proxy.KeyRouter).Shards, 2)
+	}
+
+	for _, upstreams := range [][]string{{"a:1", "b:2"}, {"x=a:1"}, {"7=a:1", "7=b:2"}} {
+		_, err = newRouter("space", upstreams, newPool)
+		assert.Error(err, "%v", upstreams)
+	}
+
+	_, err = newRouter("random", nil, newPool)
+	assert.Error(err)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// splitAddr returns space number of "host:port/space" address or DSN, 0 if it is omitted.
+// Unix socket address "unix:/path/to.sock" has no space.
+func splitAddr(addr string) (uint32, error) {
+	if strings.HasPrefix(addr, "tnt://") || strings.HasPrefix(addr, "tnt+unix://") {
+		_, opts, err := tnt.ParseDSN(addr)
+		if err != nil {
+			return 0, err
+		}
+		space, _ := opts.DefaultSpace.(uint32)
+		return space, nil
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		return 0, nil
+	}
+	i := strings.IndexByte(addr, '/')
+	if i < 0 {
+		return 0, nil
+	}
+	space, err := strconv.ParseUint(addr[i+1:], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Wrong space: %s", addr[i+1:])
+	}
+	return uint32(space), nil
+}
+
+// parseTuple packs args typed by prefix or by types, untyped args beyond types are strings.
+func parseTuple(args []string, types func(i int) tnt.FieldType) (tnt.Tuple, error) {
+	tuple := make(tnt.Tuple, len(args))
+	for i, arg := range args {
+		field, err := tnt.ParseTypedField(arg, types(i))
+		if err != nil {
+			return nil, fmt.Errorf("field %d %q: %s", i, arg, err)
+		}
+		tuple[i] = field
+	}
+	return tuple, nil
+}
+
+// keyTypes returns types of index parts, Raw for unknown ones.
+func keyTypes(space *tnt.SpaceConfig, index uint32) func(i int) tnt.FieldType {
+	types := space.KeyTypes(index)
+	return func(i int) tnt.FieldType {
+		if i < len(types) {
+			return types[i]
+		}
+		return tnt.Raw
+	}
+}
+
+func parseInsertMode(mode string) (tnt.InsertMode, error) {
+	switch mode {
+	case "":
+		return tnt.InsertOrReplace, nil
+	case "add":
+		return tnt.InsertAdd, nil
+	case "replace":
+		return tnt.InsertReplace, nil
+	}
+	return 0, fmt.Errorf("unknown insert mode %q", mode)
+}
+
+var opRegexp = regexp.MustCompile(`^(\d+)([=+&^|!#:])(.*)$`)
+
+func isOp(arg string) bool {
+	return opRegexp.MatchString(arg)
+}
+
+// parseOp parses update operation "<field><op><value>", where op is one of
+//
+//	=  set field
+//	+  add number
+//	&  bitwise and
+//	^  bitwise xor
+//	|  bitwise or
+//	!  insert field before
+//	#  delete field, value is ignored
+//	:  splice, value is "offset,length,string"
+func parseOp(arg string, space *tnt.SpaceConfig) (tnt.Operator, error) {
+	m := opRegexp.FindStringSubmatch(arg)
+	if m == nil {
+		return tnt.Operator{}, fmt.Errorf("wrong operation %q", arg)
+	}
+
+	n, err := strconv.ParseUint(m[1], 10, 32)
+	if err != nil {
+		return tnt.Operator{}, fmt.Errorf("wrong operation %q: %s", arg, err)
+	}
+	field := uint32(n)
+	t := space.FieldType(int(field))
+
+	if m[2] == "#" {
+		return tnt.OpDelete(field, nil), nil
+	}
+
+	if m[2] == ":" {
+		parts := strings.SplitN(m[3], ",", 3)
+		if len(parts) != 3 {
+			return tnt.Operator{}, fmt.Errorf("wrong splice %q: offset,length,string expected", arg)
+		}
+		offset, err := strconv.ParseInt(parts[0], 10, 32)
+		if err != nil {
+			return tnt.Operator{}, fmt.Errorf("wrong splice %q: %s", arg, err)
+		}
+		length, err := strconv.ParseInt(parts[1], 10, 32)
+		if err != nil {
+			return tnt.Operator{}, fmt.Errorf("wrong splice %q: %s", arg, err)
+		}
+		value, err := tnt.ParseField(parts[2])
+		if err != nil {
+			return tnt.Operator{}, fmt.Errorf("wrong splice %q: %s", arg, err)
+		}
+		return tnt.OpSplice(field, int32(offset), int32(length), value), nil
+	}
+
+	// arithmetic is defined for numbers only
+	if t == tnt.Raw && strings.ContainsAny(m[2], "+&^|") {
+		t = tnt.Num
+	}
+
+	value, err := tnt.ParseTypedField(m[3], t)
+	if err != nil {
+		return tnt.Operator{}, fmt.Errorf("wrong operation %q: %s", arg, err)
+	}
+
+	switch m[2] {
+	case "=":
+		return tnt.OpSet(field, value), nil
+	case "+":
+		return tnt.OpAdd(field, value), nil
+	case "&":
+		return tnt.OpAnd(field, value), nil
+	case "^":
+		return tnt.OpXor(field, value), nil
+	case "|":
+		return tnt.OpOr(field, value), nil
+	default:
+		return tnt.OpInsert(field, value), nil
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	space, err := splitAddr("127.0.0.1:2001/7")
+	assert.NoError(err)
+	assert.Equal(uint32(7), space)
+
+	space, err = splitAddr("127.0.0.1:2001")
+	assert.NoError(err)
+	assert.Equal(uint32(0), space)
+
+	_, err = splitAddr("127.0.0.1:2001/x")
+	assert.Error(err)
+
+	space, err = splitAddr("unix:/var/run/box.sock")
+	assert.NoError(err)
+	assert.Equal(uint32(0), space)
+
+	space, err = splitAddr("tnt://127.0.0.1:2001/7?query_timeout=1s")
+	assert.NoError(err)
+	assert.Equal(uint32(7), space)
+
+	_, err = splitAddr("tnt://127.0.0.1:2001/7?query_timeout=x")
+	assert.Error(err)
+}
+
+func TestParseTuple(t *testing.T) {
+	assert := assert.New(t)
+
+	space := &tnt.SpaceConfig{
+		Fields:  []tnt.FieldConfig{{Type: tnt.Num}, {Type: tnt.Str}},
+		Indexes: []tnt.IndexConfig{{Parts: []tnt.Part{{Field: 0, Type: tnt.Num64}}}},
+	}
+
+	tuple, err := parseTuple([]string{"1", "2", "3", "num:4"}, space.FieldType)
+	assert.NoError(err)
+	assert.Equal(tnt.Tuple{tnt.PackInt(1), tnt.Bytes("2"), tnt.Bytes("3"), tnt.PackInt(4)}, tuple)
+
+	tuple, err = parseTuple([]string{"1"}, keyTypes(space, 0))
+	assert.NoError(err)
+	assert.Equal(tnt.Tuple{tnt.PackLong(1)}, tuple)
+
+	_, err = parseTuple([]string{"x"}, space.FieldType)
+	assert.Error(err)
+}
+
+func TestParseOp(t *testing.T) {
+	assert := assert.New(t)
+
+	space := &tnt.SpaceConfig{Fields: []tnt.FieldConfig{{Type: tnt.Num}, {Type: tnt.Str}, {Type: tnt.Num64}}}
+
+	cases := []struct {
+		arg string
+		op  tnt.Operator
+	}{
+		{"1=foo", tnt.OpSet(1, tnt.Bytes("foo"))},
+		{"0=7", tnt.OpSet(0, tnt.PackInt(7))},
+		{"2+1", tnt.OpAdd(2, tnt.PackLong(1))},
+		{"5+1", tnt.OpAdd(5, tnt.PackInt(1))},
+		{"5&num64:3", tnt.OpAnd(5, tnt.PackLong(3))},
+		{"0^1", tnt.OpXor(0, tnt.PackInt(1))},
+		{"0|1", tnt.OpOr(0, tnt.PackInt(1))},
+		{"1!bar", tnt.OpInsert(1, tnt.Bytes("bar"))},
+		{"1#", tnt.OpDelete(1, nil)},
+		{"1:0,2,a,b", tnt.OpSplice(1, 0, 2, tnt.Bytes("a,b"))},
+	}
+	for _, c := range cases {
+		assert.True(isOp(c.arg), c.arg)
+		op, err := parseOp(c.arg, space)
+		assert.NoError(err, c.arg)
+		assert.Equal(c.op, op, c.arg)
+	}
+
+	assert.False(isOp("num:1"))
+	assert.False(isOp("key"))
+
+	for _, arg := range []string{"0=x", "1:0,a", "1:x,1,a", "9+x"} {
+		_, err := parseOp(arg, space)
+		assert.Error(err, arg)
+	}
+}
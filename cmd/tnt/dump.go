@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// rowWriter writes tuples as JSON arrays per line or as CSV records without header.
+// Fields are typed values by the space description, see tnt.FieldType.Decode.
+type rowWriter struct {
+	space *tnt.SpaceConfig
+	buf   *bufio.Writer
+	json  *json.Encoder
+	csv   *csv.Writer
+}
+
+func newRowWriter(w io.Writer, space *tnt.SpaceConfig, isCSV bool) *rowWriter {
+	rw := &rowWriter{space: space, buf: bufio.NewWriter(w)}
+	if isCSV {
+		rw.csv = csv.NewWriter(rw.buf)
+	} else {
+		rw.json = json.NewEncoder(rw.buf)
+	}
+	return rw
+}
+
+func (rw *rowWriter) Write(tuple tnt.Tuple) error {
+	row, err := rw.space.DecodeTuple(tuple)
+	if err != nil {
+		return err
+	}
+
+	if rw.json != nil {
+		return rw.json.Encode(row)
+	}
+
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = fmt.Sprint(value)
+	}
+	return rw.csv.Write(record)
+}
+
+func (rw *rowWriter) Flush() error {
+	if rw.csv != nil {
+		rw.csv.Flush()
+		if err := rw.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return rw.buf.Flush()
+}
+
+// rowReader reads tuples written by rowWriter.
+type rowReader struct {
+	space *tnt.SpaceConfig
+	lines *bufio.Scanner
+	csv   *csv.Reader
+	line  int
+}
+
+func newRowReader(r io.Reader, space *tnt.SpaceConfig, isCSV bool) *rowReader {
+	rr := &rowReader{space: space}
+	if isCSV {
+		rr.csv = csv.NewReader(r)
+		rr.csv.FieldsPerRecord = -1
+		rr.csv.ReuseRecord = true
+	} else {
+		rr.lines = bufio.NewScanner(r)
+		rr.lines.Buffer(nil, 64*1024*1024)
+	}
+	return rr
+}
+
+// rowError is the error of malformed row, reading can be continued after it.
+type rowError struct {
+	line int
+	err  error
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.err)
+}
+
+// Read returns io.EOF at the end of input and *rowError for malformed row.
+// Other errors mean the input is broken.
+func (rr *rowReader) Read() (tnt.Tuple, error) {
+	if rr.csv != nil {
+		record, err := rr.csv.Read()
+		if err != nil {
+			return nil, err
+		}
+		rr.line, _ = rr.csv.FieldPos(0)
+
+		tuple := make(tnt.Tuple, len(record))
+		for i, s := range record {
+			if tuple[i], err = rr.space.FieldType(i).Parse(s); err != nil {
+				return nil, &rowError{rr.line, fmt.Errorf("field %s: %s", rr.space.FieldName(i), err)}
+			}
+		}
+		return tuple, nil
+	}
+
+	for {
+		if !rr.lines.Scan() {
+			if err := rr.lines.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		rr.line++
+		if len(bytes.TrimSpace(rr.lines.Bytes())) != 0 {
+			break
+		}
+	}
+
+	var row []interface{}
+	dec := json.NewDecoder(bytes.NewReader(rr.lines.Bytes()))
+	dec.UseNumber()
+	if err := dec.Decode(&row); err != nil {
+		return nil, &rowError{rr.line, err}
+	}
+
+	tuple, err := rr.space.EncodeTuple(row)
+	if err != nil {
+		return nil, &rowError{rr.line, err}
+	}
+	return tuple, nil
+}
+
+// progress reports count of processed tuples and throughput to w every second.
+type progress struct {
+	name   string
+	w      io.Writer
+	start  time.Time
+	count  int64
+	errors int64
+	stop   chan bool
+	done   chan bool
+}
+
+func startProgress(name string, w io.Writer) *progress {
+	p := &progress{
+		name:  name,
+		w:     w,
+		start: time.Now(),
+		stop:  make(chan bool),
+		done:  make(chan bool),
+	}
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *progress) add(count int64) {
+	atomic.AddInt64(&p.count, count)
+}
+
+func (p *progress) fail() {
+	atomic.AddInt64(&p.errors, 1)
+}
+
+func (p *progress) report() {
+	elapsed := time.Since(p.start)
+	count := atomic.LoadInt64(&p.count)
+	fmt.Fprintf(p.w, "%s: %d tuples, %d errors, %s, %.0f tuples/s\n",
+		p.name, count, atomic.LoadInt64(&p.errors), elapsed.Truncate(time.Millisecond), float64(count)/elapsed.Seconds())
+}
+
+// finish stops periodic reports and writes the final one.
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.done
+	p.report()
+}
+
+func (c *client) dumpCmd(args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	index := flags.Int("index", -1, "TREE index to iterate, the first TREE index of schema by default")
+	batch := flags.Uint("batch", 1000, "tuples per select")
+	isCSV := flags.Bool("csv", false, "write CSV instead of JSON lines")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *batch == 0 {
+		return errors.New("dump: batch must be positive")
+	}
+
+	indexNo := uint32(0)
+	if *index >= 0 {
+		indexNo = uint32(*index)
+	} else if c.space != nil {
+		found := false
+		for i, config := range c.space.Indexes {
+			if config.Type == tnt.Tree {
+				indexNo, found = uint32(i), true
+				break
+			}
+		}
+		if !found {
+			return errors.New("dump: space has no TREE index")
+		}
+	}
+
+	out, closeOut, err := openOutput(flags.Arg(0), c.stdout)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	w := newRowWriter(out, c.space, *isCSV)
+	p := startProgress("dump", c.stderr)
+	defer p.finish()
+
+	d := &dumper{c: c, index: indexNo, batch: uint32(*batch)}
+	if c.space != nil && int(indexNo) < len(c.space.Indexes) && c.space.Indexes[indexNo].Unique {
+		d.parts = c.space.Indexes[indexNo].Parts
+	}
+	for done := false; !done; {
+		var tuples []tnt.Tuple
+		tuples, done, err = d.next()
+		if err != nil {
+			return fmt.Errorf("dump: offset %d: %s", d.count, err)
+		}
+
+		for _, tuple := range tuples {
+			if err := w.Write(tuple); err != nil {
+				return fmt.Errorf("dump: offset %d: %s", d.count, err)
+			}
+		}
+		p.add(int64(len(tuples)))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return closeOut()
+}
+
+// dumper reads all the tuples of TREE index by batches. The first batch is selected by the empty key.
+// If the index is unique and its parts are known from schema, next batches are read by box.select_range
+// from the last key, each of them costs O(batch). Otherwise they are selected with Offset, so the box
+// skips all the dumped tuples every time and the whole dump is O(n²/batch).
+//
+// Neither way is a consistent snapshot of a changing space. Paged by key, tuples existing during
+// the whole dump are written exactly once. Paged by Offset, inserts and deletes shift the following
+// tuples, which are skipped or written twice.
+type dumper struct {
+	c       *client
+	index   uint32
+	batch   uint32
+	parts   []tnt.Part // parts of unique index, nil means paging by Offset
+	count   uint32
+	lastKey tnt.Tuple
+}
+
+// next returns the next batch and true if it is the last one.
+func (d *dumper) next() ([]tnt.Tuple, bool, error) {
+	if d.lastKey == nil || d.parts == nil {
+		tuples, err := d.c.exec(&tnt.Select{
+			Tuples: []tnt.Tuple{{}},
+			Index:  d.index,
+			Offset: d.count,
+			Limit:  d.batch,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return d.add(tuples, uint32(len(tuples)) < d.batch)
+	}
+
+	// the range starts with the last key, which is dumped already
+	args := tnt.Tuple{
+		tnt.Bytes(strconv.FormatUint(uint64(d.c.space.ID), 10)),
+		tnt.Bytes(strconv.FormatUint(uint64(d.index), 10)),
+		tnt.Bytes(strconv.FormatUint(uint64(d.batch)+1, 10)),
+	}
+	tuples, err := d.c.exec(&tnt.Call{
+		Name:        tnt.Bytes("box.select_range"),
+		Tuple:       append(args, d.lastKey...),
+		ReturnTuple: true,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	done := uint32(len(tuples)) <= d.batch
+	if len(tuples) > 0 && d.keyEqual(tuples[0], d.lastKey) {
+		tuples = tuples[1:]
+	}
+	return d.add(tuples, done)
+}
+
+func (d *dumper) add(tuples []tnt.Tuple, done bool) ([]tnt.Tuple, bool, error) {
+	d.count += uint32(len(tuples))
+	if len(tuples) > 0 && d.parts != nil {
+		key, err := d.key(tuples[len(tuples)-1])
+		if err != nil {
+			return nil, false, err
+		}
+		d.lastKey = key
+	}
+	return tuples, done, nil
+}
+
+func (d *dumper) key(tuple tnt.Tuple) (tnt.Tuple, error) {
+	key := make(tnt.Tuple, len(d.parts))
+	for i, part := range d.parts {
+		if int(part.Field) >= len(tuple) {
+			return nil, fmt.Errorf("tuple has no key field %d", part.Field)
+		}
+		key[i] = tuple[part.Field]
+	}
+	return key, nil
+}
+
+func (d *dumper) keyEqual(tuple tnt.Tuple, key tnt.Tuple) bool {
+	for i, part := range d.parts {
+		if int(part.Field) >= len(tuple) || !bytes.Equal(tuple[part.Field], key[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *client) loadCmd(args []string) error {
+	flags := flag.NewFlagSet("load", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	concurrency := flags.Int("concurrency", 64, "number of inserts in flight")
+	isCSV := flags.Bool("csv", false, "read CSV instead of JSON lines")
+	mode := flags.String("mode", "", "add fails if key exists, replace fails if it doesn't")
+	maxErrors := flags.Int64("max-errors", 0, "stop after so many errors, 0 means never")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *concurrency <= 0 {
+		return errors.New("load: concurrency must be positive")
+	}
+
+	insertMode, err := parseInsertMode(*mode)
+	if err != nil {
+		return err
+	}
+
+	in, closeIn, err := openInput(flags.Arg(0), os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	type row struct {
+		line  int
+		tuple tnt.Tuple
+	}
+
+	p := startProgress("load", c.stderr)
+	stop := make(chan bool)
+	var stopOnce sync.Once
+	fail := func(err error) {
+		fmt.Fprintln(c.stderr, err)
+		p.fail()
+		if *maxErrors > 0 && atomic.LoadInt64(&p.errors) >= *maxErrors {
+			stopOnce.Do(func() { close(stop) })
+		}
+	}
+
+	// connection pipelines requests of all the workers
+	rows := make(chan row, *concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range rows {
+				if _, err := c.exec(&tnt.Insert{Tuple: r.tuple, Mode: insertMode}); err != nil {
+					fail(&rowError{r.line, err})
+					continue
+				}
+				p.add(1)
+			}
+		}()
+	}
+
+	r := newRowReader(in, c.space, *isCSV)
+	var readErr error
+read:
+	for {
+		tuple, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*rowError); !ok {
+				readErr = err
+				break
+			}
+			fail(err)
+			continue
+		}
+
+		select {
+		case rows <- row{line: r.line, tuple: tuple}:
+		case <-stop:
+			break read
+		}
+	}
+	close(rows)
+	wg.Wait()
+	p.finish()
+
+	if readErr != nil {
+		return fmt.Errorf("load: %s", readErr)
+	}
+	if errs := atomic.LoadInt64(&p.errors); errs != 0 {
+		return fmt.Errorf("load: %d tuples failed", errs)
+	}
+	return nil
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// openOutput returns file or stdout if name is empty or "-".
+func openOutput(name string, stdout io.Writer) (io.Writer, func() error, error) {
+	if name == "" || name == "-" {
+		return stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// openInput returns file or stdin if name is empty or "-".
+func openInput(name string, stdin io.Reader) (io.Reader, func() error, error) {
+	if name == "" || name == "-" {
+		return stdin, func() error { return nil }, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/lomik/go-tnt/tnttest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowRoundTrip(t *testing.T) {
+	space := &tnt.SpaceConfig{Fields: []tnt.FieldConfig{{Type: tnt.Num}, {Type: tnt.Str}, {Type: tnt.Num64}}}
+	tuples := []tnt.Tuple{
+		{tnt.PackInt(1), tnt.Bytes("a,\"b\"\nc"), tnt.PackLong(1 << 40)},
+		{tnt.PackInt(2), tnt.Bytes(""), tnt.PackLong(0), tnt.Bytes{0, 1}, tnt.Bytes("num:1")},
+	}
+
+	for _, isCSV := range []bool{false, true} {
+		for _, s := range []*tnt.SpaceConfig{space, nil} {
+			var buf bytes.Buffer
+			w := newRowWriter(&buf, s, isCSV)
+			for _, tuple := range tuples {
+				assert.NoError(t, w.Write(tuple))
+			}
+			assert.NoError(t, w.Flush())
+
+			r := newRowReader(&buf, s, isCSV)
+			for _, tuple := range tuples {
+				read, err := r.Read()
+				assert.NoError(t, err)
+				assert.Equal(t, tuple, read, "csv=%v schema=%v", isCSV, s != nil)
+			}
+			_, err := r.Read()
+			assert.Equal(t, io.EOF, err)
+		}
+	}
+}
+
+func TestRowWriterJSON(t *testing.T) {
+	space := &tnt.SpaceConfig{Fields: []tnt.FieldConfig{{Type: tnt.Num}, {Type: tnt.Str}}}
+
+	var buf bytes.Buffer
+	w := newRowWriter(&buf, space, false)
+	assert.NoError(t, w.Write(tnt.Tuple{tnt.PackInt(42), tnt.Bytes("foo"), tnt.Bytes{0xff}}))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "[42,\"foo\",\"hex:ff\"]\n", buf.String())
+
+	assert.Error(t, w.Write(tnt.Tuple{tnt.Bytes("x")}))
+}
+
+func TestRowReaderErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	space := &tnt.SpaceConfig{Fields: []tnt.FieldConfig{{Type: tnt.Num}}}
+
+	r := newRowReader(strings.NewReader("[1]\n\n[\"x\"]\nbroken\n[2]\n"), space, false)
+	tuple, err := r.Read()
+	assert.NoError(err)
+	assert.Equal(tnt.Tuple{tnt.PackInt(1)}, tuple)
+
+	_, err = r.Read()
+	if assert.IsType(&rowError{}, err) {
+		assert.Equal(3, err.(*rowError).line)
+	}
+
+	_, err = r.Read()
+	if assert.IsType(&rowError{}, err) {
+		assert.Equal(4, err.(*rowError).line)
+	}
+
+	tuple, err = r.Read()
+	assert.NoError(err)
+	assert.Equal(tnt.Tuple{tnt.PackInt(2)}, tuple)
+
+	r = newRowReader(strings.NewReader("1\nx\n\"broken\n"), space, true)
+	_, err = r.Read()
+	assert.NoError(err)
+
+	_, err = r.Read()
+	if assert.IsType(&rowError{}, err) {
+		assert.Equal(2, err.(*rowError).line)
+	}
+
+	// broken CSV can't be read further
+	_, err = r.Read()
+	assert.Error(err)
+	assert.NotEqual(io.EOF, err)
+	assert.IsType(&csv.ParseError{}, err)
+}
+
+func TestDump(t *testing.T) {
+	assert := assert.New(t)
+
+	schema := &tnt.Schema{Spaces: []tnt.SpaceConfig{{
+		ID:      1,
+		Fields:  []tnt.FieldConfig{{Type: tnt.Num}, {Type: tnt.Str}},
+		Indexes: []tnt.IndexConfig{{Type: tnt.Tree, Unique: true, Parts: []tnt.Part{{Field: 0, Type: tnt.Num}}}},
+	}}}
+	conn, err := tnttest.NewMemConnection(schema)
+	require.NoError(t, err)
+	conn.SetDefaultSpace(1)
+	for _, id := range []uint32{5, 3, 1, 4, 2} {
+		_, err := conn.Execute(&tnt.Insert{Tuple: tnt.Tuple{tnt.PackInt(id), tnt.Bytes("x")}})
+		require.NoError(t, err)
+	}
+
+	// box.select_range of the primary NUM index
+	var ranges int
+	conn.RegisterProc("box.select_range", func(args tnt.Tuple) ([]tnt.Tuple, error) {
+		ranges++
+		limit, _ := strconv.Atoi(string(args[2]))
+		var result []tnt.Tuple
+		for _, tuple := range conn.Tuples(1) {
+			if len(result) < limit && tnt.UnpackInt(tuple[0]) >= tnt.UnpackInt(args[3]) {
+				result = append(result, tuple)
+			}
+		}
+		return result, nil
+	})
+
+	var offsets int
+	conn.InjectFault(tnttest.QueryFault{Match: func(q tnt.Query) bool {
+		if s, ok := q.(*tnt.Select); ok && s.Offset > 0 {
+			offsets++
+		}
+		return false
+	}})
+
+	for _, space := range []*tnt.SpaceConfig{&schema.Spaces[0], nil} {
+		ranges, offsets = 0, 0
+		var stdout, stderr bytes.Buffer
+		c := &client{conn: conn, space: space, timeout: time.Second, stdout: &stdout, stderr: &stderr}
+		assert.NoError(c.dumpCmd([]string{"-batch", "2"}))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		if assert.Len(lines, 5) && space != nil {
+			assert.Equal("[1,\"x\"]", lines[0])
+			assert.Equal("[5,\"x\"]", lines[4])
+		}
+
+		// unique index of schema is paged by key, otherwise by offset
+		if space != nil {
+			assert.Equal(2, ranges)
+			assert.Equal(0, offsets)
+		} else {
+			assert.Equal(0, ranges)
+			assert.Equal(2, offsets)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Command tnt runs ad-hoc queries against tarantool 1.5 box.
+//
+// Usage:
+//
+//	tnt [flags] <command> host:port/space [args...]
+//
+// The address may be DSN as well, see tnt.ParseDSN. Its timeouts override -timeout.
+//
+// Commands:
+//
+//	select addr [-index N] [-limit N] [-offset N] key...
+//	insert addr [-mode add|replace] field...
+//	update addr key... op...
+//	delete addr key...
+//	call addr proc arg...
+//	ping addr
+//	dump addr [-index N] [-batch N] [-csv] [file]
+//	load addr [-concurrency N] [-csv] [-mode add|replace] [-max-errors N] [file]
+//
+// Fields are typed by prefix: num:42, num64:42, str:foo or hex:0a0b.
+// Fields without prefix are typed by the -schema file if it describes them, otherwise they are sent as strings.
+// Update operations are described in parseOp.
+//
+// Dump writes the whole space as JSON array or CSV record per tuple, fields are typed by the schema.
+// Load inserts tuples written by dump, progress and failed lines are reported to stderr.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+type client struct {
+	conn    tnt.IConnection
+	space   *tnt.SpaceConfig
+	format  string
+	timeout time.Duration
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+type command func(c *client, args []string) error
+
+var commands = map[string]command{
+	"select": (*client).selectCmd,
+	"insert": (*client).insertCmd,
+	"update": (*client).updateCmd,
+	"delete": (*client).deleteCmd,
+	"call":   (*client).callCmd,
+	"ping":   (*client).pingCmd,
+	"dump":   (*client).dumpCmd,
+	"load":   (*client).loadCmd,
+}
+
+var errUsage = errors.New("Usage: tnt [-schema file] [-format table|json] [-timeout 5s] <select|insert|update|delete|call|ping|dump|load> host:port/space [args...]")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("tnt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	schemaFile := flags.String("schema", "", "JSON schema of spaces")
+	format := flags.String("format", "table", "output format: table or json")
+	timeout := flags.Duration("timeout", 5*time.Second, "connect and query timeout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	args = flags.Args()
+	if len(args) < 2 {
+		return errUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	addr := args[1]
+	spaceID, err := splitAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	var schema *tnt.Schema
+	if *schemaFile != "" {
+		if schema, err = tnt.LoadSchema(*schemaFile); err != nil {
+			return err
+		}
+	}
+
+	conn, err := tnt.Connect(addr, &tnt.Options{
+		ConnectTimeout: *timeout,
+		QueryTimeout:   *timeout,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// load reports errors from many goroutines
+	stderr = &lockedWriter{w: stderr}
+
+	c := &client{
+		conn:    conn,
+		space:   schema.Space(spaceID),
+		format:  *format,
+		timeout: *timeout,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+
+	return cmd(c, args[2:])
+}
+
+func (c *client) exec(q tnt.Query) ([]tnt.Tuple, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	return c.conn.Exec(ctx, q)
+}
+
+func (c *client) selectCmd(args []string) error {
+	flags := flag.NewFlagSet("select", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	index := flags.Uint("index", 0, "index number")
+	limit := flags.Uint("limit", 100, "max number of tuples")
+	offset := flags.Uint("offset", 0, "number of tuples to skip")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := parseTuple(flags.Args(), keyTypes(c.space, uint32(*index)))
+	if err != nil {
+		return err
+	}
+
+	tuples, err := c.exec(&tnt.Select{
+		Tuples: []tnt.Tuple{key},
+		Index:  uint32(*index),
+		Limit:  uint32(*limit),
+		Offset: uint32(*offset),
+	})
+	if err != nil {
+		return err
+	}
+	return c.print(tuples)
+}
+
+func (c *client) insertCmd(args []string) error {
+	flags := flag.NewFlagSet("insert", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	mode := flags.String("mode", "", "add fails if key exists, replace fails if it doesn't")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	insertMode, err := parseInsertMode(*mode)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return errors.New("insert: tuple is required")
+	}
+
+	q := &tnt.Insert{ReturnTuple: true, Mode: insertMode}
+	if q.Tuple, err = parseTuple(flags.Args(), c.space.FieldType); err != nil {
+		return err
+	}
+
+	tuples, err := c.exec(q)
+	if err != nil {
+		return err
+	}
+	return c.print(tuples)
+}
+
+func (c *client) updateCmd(args []string) error {
+	keyLen := 0
+	for keyLen < len(args) && !isOp(args[keyLen]) {
+		keyLen++
+	}
+	if keyLen == 0 || keyLen == len(args) {
+		return errors.New("update: key and operations are required")
+	}
+
+	key, err := parseTuple(args[:keyLen], keyTypes(c.space, 0))
+	if err != nil {
+		return err
+	}
+
+	q := &tnt.Update{Tuple: key, ReturnTuple: true}
+	for _, arg := range args[keyLen:] {
+		op, err := parseOp(arg, c.space)
+		if err != nil {
+			return err
+		}
+		q.Ops = append(q.Ops, op)
+	}
+
+	tuples, err := c.exec(q)
+	if err != nil {
+		return err
+	}
+	return c.print(tuples)
+}
+
+func (c *client) deleteCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("delete: key is required")
+	}
+
+	key, err := parseTuple(args, keyTypes(c.space, 0))
+	if err != nil {
+		return err
+	}
+
+	tuples, err := c.exec(&tnt.Delete{Tuple: key, ReturnTuple: true})
+	if err != nil {
+		return err
+	}
+	return c.print(tuples)
+}
+
+func (c *client) callCmd(args []string) error {
+	if len(args) == 0 {
+		return errors.New("call: procedure name is required")
+	}
+
+	// arguments of lua procedures are strings unless typed explicitly
+	tuple, err := parseTuple(args[1:], func(int) tnt.FieldType { return tnt.Raw })
+	if err != nil {
+		return err
+	}
+
+	tuples, err := c.exec(&tnt.Call{Name: tnt.Bytes(args[0]), Tuple: tuple, ReturnTuple: true})
+	if err != nil {
+		return err
+	}
+	return c.print(tuples)
+}
+
+func (c *client) pingCmd(args []string) error {
+	start := time.Now()
+	if _, err := c.exec(&tnt.Ping{}); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "ok %s\n", time.Since(start))
+	return nil
+}
+
+// print writes tuples as a table with header or as JSON array per line.
+func (c *client) print(tuples []tnt.Tuple) error {
+	rows := make([][]interface{}, len(tuples))
+	width := 0
+	for i, tuple := range tuples {
+		row, err := c.space.DecodeTuple(tuple)
+		if err != nil {
+			// the schema doesn't match, show the tuple as is
+			row, _ = (*tnt.SpaceConfig)(nil).DecodeTuple(tuple)
+		}
+		rows[i] = row
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	if c.format == "json" {
+		enc := json.NewEncoder(c.stdout)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	for i := 0; i < width; i++ {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, c.space.FieldName(i))
+	}
+	fmt.Fprintln(w)
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, value)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "(%d tuples)\n", len(rows))
+	return w.Flush()
+}
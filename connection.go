@@ -2,27 +2,50 @@ package tnt
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 )
 
+// Connect connects to the box at "host:port/space", "unix:/path/to.sock" or DSN (see ParseDSN).
 func Connect(addr string, opts *Options) (connection *Connection, err error) {
+	if addr, opts, err = resolveAddr(addr, opts); err != nil {
+		return nil, err
+	}
+
+	// defaults are set to the copy, as options may be shared by connections of Pool
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	opts = &o
+
+	requestChanSize := 1024
+	if opts.MaxInFlight > 0 {
+		requestChanSize = opts.MaxInFlight
+	}
+
+	requestMapSize := defaultRequestMapSize
+	if opts.MaxInFlight > requestMapSize {
+		requestMapSize = opts.MaxInFlight
+	}
+
 	connection = &Connection{
 		addr:        addr,
-		requests:    newRequestMap(),
-		requestChan: make(chan *request, 1024),
+		requests:    newRequestMap(requestMapSize),
+		requestChan: make(chan *request, requestChanSize),
 		exit:        make(chan bool),
 		closed:      make(chan bool),
+		draining:    make(chan bool),
 	}
 
-	if opts == nil {
-		opts = &Options{}
+	if opts.MaxInFlight > 0 {
+		connection.inFlight = make(chan struct{}, opts.MaxInFlight)
 	}
 
 	if opts.ConnectTimeout.Nanoseconds() == 0 {
@@ -37,14 +60,17 @@ func Connect(addr string, opts *Options) (connection *Connection, err error) {
 		opts.MemcacheSpace = uint32(23)
 	}
 
+	if opts.Logger == nil {
+		opts.Logger = nopLogger{}
+	}
+
 	var defaultSpace uint32
 
-	splittedAddr := strings.Split(addr, "/")
-	remoteAddr := splittedAddr[0]
-	if len(splittedAddr) > 1 {
-		i, err := strconv.Atoi(splittedAddr[1])
+	remoteAddr, space := splitAddr(addr)
+	if space != "" {
+		i, err := strconv.Atoi(space)
 		if err != nil {
-			return nil, fmt.Errorf("Wrong space: %s", splittedAddr[1])
+			return nil, fmt.Errorf("Wrong space: %s", space)
 		}
 		defaultSpace = uint32(i)
 	}
@@ -57,11 +83,13 @@ func Connect(addr string, opts *Options) (connection *Connection, err error) {
 		defaultSpace = i
 	}
 
-	connection.memcacheSpace = opts.MemcacheSpace
+	connection.executor.init(opts, connection.execute)
 	connection.queryTimeout = opts.QueryTimeout
 	connection.defaultSpace = defaultSpace
+	connection.logger = opts.Logger
+	connection.failFast = opts.FailOnMaxInFlight
 
-	connection.tcpConn, err = net.DialTimeout("tcp", remoteAddr, opts.ConnectTimeout)
+	connection.tcpConn, err = dialTimeout(opts.Dialer, remoteAddr, opts.ConnectTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -71,18 +99,56 @@ func Connect(addr string, opts *Options) (connection *Connection, err error) {
 	return
 }
 
-func (conn *Connection) nextID() uint32 {
-	return atomic.AddUint32(&conn.requestID, 1)
+// unixPrefix marks address of Unix domain socket, e.g. "unix:/var/run/tarantool.sock".
+const unixPrefix = "unix:"
+
+// splitAddr splits "host:port/space" into the remote address and the space, which is empty if omitted.
+// Unix socket address has no space, Options.DefaultSpace is used for it.
+func splitAddr(addr string) (remoteAddr string, space string) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		return addr, ""
+	}
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		return addr[:i], addr[i+1:]
+	}
+	return addr, ""
 }
 
+// dial connects to TCP address or Unix socket with unixPrefix.
+func dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if strings.HasPrefix(addr, unixPrefix) {
+		return d.DialContext(ctx, "unix", addr[len(unixPrefix):])
+	}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// dialTimeout connects by dialer or by dial if it is nil.
+func dialTimeout(dialer func(ctx context.Context, addr string) (net.Conn, error), addr string, timeout time.Duration) (net.Conn, error) {
+	if dialer == nil {
+		dialer = dial
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dialer(ctx, addr)
+}
+
+// newRequest packs q and registers it in the request map.
 func (conn *Connection) newRequest(q Query) (reqID uint32, r *request, err error) {
 	if r, _ = requestsPool.Get().(*request); r == nil {
 		r = &request{replyChan: make(chan *Response, 1)}
 	}
-	reqID = conn.nextID()
+
+	reqID, ok := conn.requests.Put(r)
+	if !ok {
+		conn.releaseRequest(r)
+		return 0, nil, ErrTooManyRequests
+	}
 
 	r.raw, err = q.Pack(reqID, conn.defaultSpace)
 	if err != nil {
+		conn.requests.Pop(reqID)
+		conn.releaseRequest(r)
 		return 0, nil, &QueryError{error: err}
 	}
 
@@ -95,44 +161,59 @@ func (conn *Connection) releaseRequest(r *request) {
 	}
 }
 
-func (conn *Connection) stop() {
+// stop closes the connection. Only the first cause is recorded, nil cause means Close call.
+func (conn *Connection) stop(cause error) {
 	conn.closeOnce.Do(func() {
 		// debug.PrintStack()
+		if cause != nil {
+			conn.err = newCausedError(ErrConnectionClosed, cause)
+			conn.logger.Printf("tnt: connection to %s closed: %s", conn.addr, cause)
+		}
 		close(conn.exit)
 		conn.tcpConn.Close()
 	})
 }
 
+// closedError returns error for requests failed due to connection close.
+// Must be called after conn.exit has been closed.
+func (conn *Connection) closedError() error {
+	if conn.err == nil {
+		return ErrConnectionClosed
+	}
+	return conn.err
+}
+
 func (conn *Connection) worker(tcpConn net.Conn) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
-		writer(tcpConn, conn.requestChan, conn.exit)
-		conn.stop()
+		err := writer(tcpConn, conn.requestChan, conn.exit)
+		conn.stop(err)
 		wg.Done()
 	}()
 
 	go func() {
-		conn.reader(tcpConn)
-		conn.stop()
+		err := conn.reader(tcpConn)
+		conn.stop(err)
 		wg.Done()
 	}()
 
 	wg.Wait()
 
 	// send error reply to all pending requests
+	closedError := conn.closedError()
 	conn.requests.CleanUp(func(req *request) {
 		req.replyChan <- &Response{
-			Error: ErrConnectionClosed,
+			Error: closedError,
 		}
 	})
 
 	close(conn.closed)
 }
 
-func writer(tcpConn net.Conn, writeChan chan *request, stopChan chan bool) {
-	var err error
+// writer returns nil if it was stopped via stopChan.
+func writer(tcpConn net.Conn, writeChan chan *request, stopChan chan bool) (err error) {
 	var n int
 	w := bufio.NewWriter(tcpConn)
 
@@ -144,8 +225,10 @@ WRITER_LOOP:
 				break WRITER_LOOP
 			}
 			n, err = w.Write(request.raw)
-			// @TODO: handle error
-			if err != nil || n != len(request.raw) {
+			if err == nil && n != len(request.raw) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
 				break WRITER_LOOP
 			}
 		case <-stopChan:
@@ -162,7 +245,10 @@ WRITER_LOOP:
 					break WRITER_LOOP
 				}
 				n, err = w.Write(request.raw)
-				if err != nil || n != len(request.raw) {
+				if err == nil && n != len(request.raw) {
+					err = io.ErrShortWrite
+				}
+				if err != nil {
 					break WRITER_LOOP
 				}
 			case <-stopChan:
@@ -170,13 +256,11 @@ WRITER_LOOP:
 			}
 		}
 	}
-	if err != nil {
-		// @TODO
-		// pp.Println(err)
-	}
+	return err
 }
 
-func (conn *Connection) reader(tcpConn net.Conn) {
+// reader returns the error which has interrupted reading, it is never nil.
+func (conn *Connection) reader(tcpConn net.Conn) error {
 	// var msgLen uint32
 	// var err error
 	header := make([]byte, 12)
@@ -193,7 +277,6 @@ func (conn *Connection) reader(tcpConn net.Conn) {
 READER_LOOP:
 	for {
 		_, err = io.ReadAtLeast(r, header, headerLen)
-		// @TODO: log error
 		if err != nil {
 			break READER_LOOP
 		}
@@ -204,14 +287,13 @@ READER_LOOP:
 		body := make([]byte, bodyLen)
 
 		_, err = io.ReadAtLeast(r, body, int(bodyLen))
-		// @TODO: log error
 		if err != nil {
 			break READER_LOOP
 		}
 
 		response, err = UnpackBody(body)
-		// @TODO: log error
 		if err != nil {
+			err = fmt.Errorf("decode response %d: %s", requestID, err)
 			break READER_LOOP
 		}
 
@@ -220,4 +302,5 @@ READER_LOOP:
 			req.replyChan <- response
 		}
 	}
+	return err
 }
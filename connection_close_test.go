@@ -1,6 +1,10 @@
 package tnt
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"sync"
 	"testing"
@@ -95,3 +99,151 @@ func TestCloseExecute(t *testing.T) {
 	assert.Error(err)
 	assert.IsType(&ConnectionError{}, err)
 }
+
+type testLogger struct {
+	sync.Mutex
+	messages []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.Lock()
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+	l.Unlock()
+}
+
+func TestCloseCause(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// read request and hang up without reply
+		c.Read(make([]byte, 1024))
+		c.Close()
+	}()
+
+	logger := &testLogger{}
+	conn, err := Connect(listener.Addr().String(), &Options{Logger: logger})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(conn.Err())
+
+	data, err := conn.Execute(&Select{
+		Value: PackInt(0),
+	})
+	assert.Nil(data)
+	assert.IsType(&ConnectionError{}, err)
+	assert.True(errors.Is(err, ErrConnectionClosed))
+	assert.True(errors.Is(err, io.EOF))
+	assert.Equal("Connection closed: EOF", err.Error())
+
+	conn.Close()
+	assert.True(errors.Is(conn.Err(), io.EOF))
+
+	logger.Lock()
+	assert.Len(logger.messages, 1)
+	logger.Unlock()
+}
+
+func TestCloseErr(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	conn, err := Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	conn.Close()
+
+	assert.Equal(ErrConnectionClosed, conn.Err())
+}
+
+func TestShutdown(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		time.Sleep(100 * time.Millisecond)
+		return emptyReply
+	})
+
+	conn, err := Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		data, err := conn.Execute(&Select{Value: PackInt(0)})
+		assert.NoError(err)
+		assert.Equal([]Tuple{}, data)
+		wg.Done()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- conn.Shutdown(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	assert.True(conn.IsClosed())
+	_, err = conn.Execute(&Select{Value: PackInt(0)})
+	assert.Equal(ErrConnectionClosed, err)
+
+	assert.NoError(<-shutdown)
+	wg.Wait()
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		return nil
+	})
+
+	conn, err := Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		_, err := conn.Execute(&Select{Value: PackInt(0)})
+		assert.Equal(ErrConnectionClosed, err)
+		wg.Done()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, conn.Shutdown(ctx))
+	wg.Wait()
+}
@@ -1,9 +1,18 @@
 package tnt
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -212,3 +221,173 @@ func BenchmarkSelect(b *testing.B) {
 		}
 	}
 }
+
+func TestMaxInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	// server accepts requests and never replies
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, c)
+	}()
+
+	conn, err := Connect(listener.Addr().String(), &Options{
+		MaxInFlight: 1,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	go conn.ExecuteOptions(&Select{Value: PackInt(0)}, &QueryOptions{Timeout: time.Second})
+	time.Sleep(10 * time.Millisecond)
+
+	started := time.Now()
+	_, err = conn.ExecuteOptions(&Select{Value: PackInt(0)}, &QueryOptions{Timeout: 50 * time.Millisecond})
+	assert.Equal(ErrRequestTimeout, err)
+	assert.True(time.Since(started) >= 50*time.Millisecond)
+}
+
+func TestMaxInFlightFailFast(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, c)
+	}()
+
+	conn, err := Connect(listener.Addr().String(), &Options{
+		MaxInFlight:       2,
+		FailOnMaxInFlight: true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		go conn.ExecuteOptions(&Select{Value: PackInt(0)}, &QueryOptions{Timeout: time.Second})
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = conn.Execute(&Select{Value: PackInt(0)})
+	assert.Equal(ErrTooManyRequests, err)
+}
+
+func TestPing(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		assert.Equal(uint32(requestTypePing), requestType)
+		assert.Empty(body)
+		return []byte{}
+	})
+
+	conn, err := Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	data, err := conn.Execute(&Ping{})
+	assert.NoError(err)
+	assert.Empty(data)
+}
+
+func TestConnectUnix(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tnt")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "box.sock"))
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	var space uint32
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		atomic.StoreUint32(&space, UnpackInt(body[0:4]))
+		return tuplesReply(Tuple{Bytes("unix")})
+	})
+
+	conn, err := Connect("unix:"+filepath.Join(dir, "box.sock"), &Options{DefaultSpace: 7})
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	data, err := conn.Execute(&Select{Value: PackInt(1)})
+	assert.NoError(err)
+	assert.Equal([]Tuple{{Bytes("unix")}}, data)
+	assert.Equal(uint32(7), atomic.LoadUint32(&space))
+
+	_, err = Connect("unix:"+filepath.Join(dir, "missing.sock"), nil)
+	assert.Error(err)
+}
+
+func TestDialer(t *testing.T) {
+	assert := assert.New(t)
+
+	var dialed string
+	opts := &Options{
+		ConnectTimeout: 100 * time.Millisecond,
+		Dialer: func(ctx context.Context, addr string) (net.Conn, error) {
+			dialed = addr
+			if _, ok := ctx.Deadline(); !ok {
+				return nil, errors.New("no deadline")
+			}
+			client, server := net.Pipe()
+			go fakeServe(server, func(requestType uint32, body []byte) []byte {
+				return tuplesReply(Tuple{PackInt(UnpackInt(body[0:4]))})
+			})
+			return client, nil
+		},
+	}
+
+	conn, err := Connect("box:2001/5", opts)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	assert.Equal("box:2001", dialed)
+
+	data, err := conn.Execute(&Select{Value: PackInt(1)})
+	assert.NoError(err)
+	assert.Equal([]Tuple{{PackInt(5)}}, data)
+
+	opts.Dialer = func(ctx context.Context, addr string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	_, err = Connect("box:2001", opts)
+	assert.Equal(context.DeadlineExceeded, err)
+}
@@ -1,24 +1,52 @@
 package tnt
 
 import (
+	"context"
 	"sync"
 )
 
+// Connector keeps connection to the box and reconnects after its close.
+// Its query methods connect on demand and run Options.Interceptors once per query.
 type Connector struct {
+	executor // first for 64-bit alignment of memcache CAS
 	sync.Mutex
 	remoteAddr string
 	options    *Options
 	conn       *Connection
+	addrErr    error
 }
 
+// New returns connector to remoteAddr, which may be DSN (see ParseDSN). Connection is established by the first query or Connect.
+// Malformed DSN is not reported by New, the first query or Connect fails with its error. Use ParseDSN to check DSN beforehand.
 func New(remoteAddr string, option *Options) *Connector {
-	return &Connector{
+	addr, opts, err := resolveAddr(remoteAddr, option)
+	if err == nil {
+		remoteAddr, option = addr, opts
+	}
+
+	c := &Connector{
 		remoteAddr: remoteAddr,
 		options:    option,
+		addrErr:    err,
 	}
+	c.executor.init(option, c.execute)
+	return c
+}
+
+// execute does the query on the current connection bypassing its interceptors.
+func (c *Connector) execute(ctx context.Context, q Query) ([]Tuple, error) {
+	conn, err := c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return conn.execute(ctx, q)
 }
 
 func (c *Connector) Connect() (*Connection, error) {
+	if c.addrErr != nil {
+		return nil, c.addrErr
+	}
+
 	var err error
 	var conn *Connection
 
@@ -41,3 +69,16 @@ func (c *Connector) Close() error {
 	c.Unlock()
 	return nil
 }
+
+// Shutdown gracefully closes current connection, see Connection.Shutdown.
+func (c *Connector) Shutdown(ctx context.Context) error {
+	c.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Shutdown(ctx)
+}
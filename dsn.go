@@ -0,0 +1,144 @@
+package tnt
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DSN schemes: "tnt://host:port/space" for TCP and "tnt+unix:///path/to.sock" for Unix socket.
+const (
+	dsnScheme     = "tnt://"
+	dsnUnixScheme = "tnt+unix://"
+)
+
+// isDSN returns true if addr is DSN rather than "host:port/space".
+func isDSN(addr string) bool {
+	return strings.HasPrefix(addr, dsnScheme) || strings.HasPrefix(addr, dsnUnixScheme)
+}
+
+// ParseDSN parses connection settings given as URL, e.g.
+//
+//	tnt://host:port/7?connect_timeout=500ms&query_timeout=1s&memcache_space=23&pool_size=4
+//	tnt+unix:///var/run/tarantool.sock?space=7
+//
+// The path or the space parameter is the default space. Other parameters are max_in_flight and
+// fail_on_max_in_flight. It returns the address for Connect and the options. Connect, New and NewPool
+// accept DSN as the address as well.
+func ParseDSN(dsn string) (addr string, opts *Options, err error) {
+	opts = &Options{}
+	if addr, err = parseDSN(dsn, opts); err != nil {
+		return "", nil, err
+	}
+	return addr, opts, nil
+}
+
+// resolveAddr returns the address and options for Connect. If addr is DSN,
+// its parameters override the copy of opts.
+func resolveAddr(addr string, opts *Options) (string, *Options, error) {
+	if !isDSN(addr) {
+		return addr, opts, nil
+	}
+
+	merged := &Options{}
+	if opts != nil {
+		*merged = *opts
+	}
+	addr, err := parseDSN(addr, merged)
+	if err != nil {
+		return "", nil, err
+	}
+	return addr, merged, nil
+}
+
+// parseDSN sets the parameters of dsn to opts.
+func parseDSN(dsn string, opts *Options) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("Wrong DSN: %s", err)
+	}
+
+	var addr string
+	switch u.Scheme {
+	case "tnt":
+		if u.Host == "" {
+			return "", fmt.Errorf("Wrong DSN %q: host is required", dsn)
+		}
+		addr = u.Host
+		if space := strings.Trim(u.Path, "/"); space != "" {
+			n, err := strconv.ParseUint(space, 10, 32)
+			if err != nil {
+				return "", fmt.Errorf("Wrong space: %s", space)
+			}
+			opts.DefaultSpace = uint32(n)
+		}
+	case "tnt+unix":
+		if u.Host != "" || u.Path == "" {
+			return "", fmt.Errorf("Wrong DSN %q: socket path is required", dsn)
+		}
+		addr = unixPrefix + u.Path
+	default:
+		return "", fmt.Errorf("Wrong DSN %q: unknown scheme %q", dsn, u.Scheme)
+	}
+
+	for name, values := range u.Query() {
+		value := values[len(values)-1]
+		if err := setDSNParam(opts, name, value); err != nil {
+			return "", fmt.Errorf("Wrong DSN parameter %s=%q: %s", name, value, err)
+		}
+	}
+
+	return addr, nil
+}
+
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+func parsePositiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return n, nil
+}
+
+func setDSNParam(opts *Options, name string, value string) error {
+	var err error
+	switch name {
+	case "connect_timeout":
+		opts.ConnectTimeout, err = parsePositiveDuration(value)
+	case "query_timeout":
+		opts.QueryTimeout, err = parsePositiveDuration(value)
+	case "space", "memcache_space":
+		var n uint64
+		if n, err = strconv.ParseUint(value, 10, 32); err == nil {
+			if name == "space" {
+				opts.DefaultSpace = uint32(n)
+			} else {
+				opts.MemcacheSpace = uint32(n)
+			}
+		}
+	case "pool_size":
+		opts.PoolSize, err = parsePositiveInt(value)
+	case "max_in_flight":
+		opts.MaxInFlight, err = parsePositiveInt(value)
+	case "fail_on_max_in_flight":
+		opts.FailOnMaxInFlight, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("unknown parameter")
+	}
+	return err
+}
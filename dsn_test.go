@@ -0,0 +1,98 @@
+package tnt
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDSN(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr, opts, err := ParseDSN("tnt://host:3013/7?connect_timeout=500ms&query_timeout=1s&memcache_space=23&pool_size=4")
+	require.NoError(err)
+	assert.Equal("host:3013", addr)
+	assert.Equal(&Options{
+		ConnectTimeout: 500 * time.Millisecond,
+		QueryTimeout:   time.Second,
+		MemcacheSpace:  uint32(23),
+		DefaultSpace:   uint32(7),
+		PoolSize:       4,
+	}, opts)
+
+	addr, opts, err = ParseDSN("tnt+unix:///var/run/box.sock?space=5&max_in_flight=100&fail_on_max_in_flight=true")
+	require.NoError(err)
+	assert.Equal("unix:/var/run/box.sock", addr)
+	assert.Equal(&Options{
+		DefaultSpace:      uint32(5),
+		MaxInFlight:       100,
+		FailOnMaxInFlight: true,
+	}, opts)
+
+	addr, opts, err = ParseDSN("tnt://host:3013")
+	require.NoError(err)
+	assert.Equal("host:3013", addr)
+	assert.Equal(&Options{}, opts)
+
+	for dsn, message := range map[string]string{
+		"http://host:3013/7":                    "unknown scheme",
+		"tnt:///7":                              "host is required",
+		"tnt+unix://host/sock":                  "socket path is required",
+		"tnt://host:3013/seven":                 "Wrong space: seven",
+		"tnt://host:3013/7?query_timeout=1":     "query_timeout",
+		"tnt://host:3013/7?pool_size=0":         "pool_size",
+		"tnt://host:3013/7?memcache_space=-":    "memcache_space",
+		"tnt://host:3013/7?timeout=1s":          "timeout",
+		"tnt://host:3013/7?connect_timeout=-1s": "connect_timeout",
+	} {
+		_, _, err := ParseDSN(dsn)
+		if assert.Error(err, dsn) {
+			assert.Contains(err.Error(), message, dsn)
+		}
+	}
+}
+
+func TestConnectDSN(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		return emptyReply
+	})
+
+	opts := &Options{MaxInFlight: 10}
+	conn, err := Connect("tnt://"+listener.Addr().String()+"/7?query_timeout=2s", opts)
+	require.NoError(err)
+	defer conn.Close()
+
+	assert.Equal(uint32(7), conn.defaultSpace)
+	assert.Equal(2*time.Second, conn.queryTimeout)
+	assert.Equal(10, cap(conn.inFlight))
+	// options of caller are not changed
+	assert.Equal(&Options{MaxInFlight: 10}, opts)
+
+	_, err = Connect("tnt://"+listener.Addr().String()+"/7?query_timeout=fast", nil)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "query_timeout")
+	}
+
+	pool := NewPool("tnt://"+listener.Addr().String()+"/7?pool_size=3", 0, nil)
+	defer pool.Close()
+	assert.Len(pool.connectors, 3)
+
+	// malformed DSN fails queries with its error
+	_, _, badErr := ParseDSN("tnt://" + listener.Addr().String() + "/7?pool_size=many")
+	require.Error(badErr)
+	badPool := NewPool("tnt://"+listener.Addr().String()+"/7?pool_size=many", 0, nil)
+	defer badPool.Close()
+	_, err = badPool.Execute(&Ping{})
+	assert.Equal(badErr, err)
+}
@@ -10,15 +10,30 @@ var (
 	// ErrConnectionClosed means connection have been closed already.
 	ErrConnectionClosed = NewConnectionError("Connection closed")
 	// ErrShredOldRequests means request ID error.
+	//
+	// Deprecated: request IDs still in use are skipped now, so it is never returned.
 	ErrShredOldRequests = NewConnectionError("Shred old requests")
+	// ErrTooManyRequests means MaxInFlight limit is reached or all request IDs are in use.
+	ErrTooManyRequests = NewConnectionError("Too many requests")
 )
 
 type ConnectionError struct {
 	error
+	cause error
 }
 
+// Error codes of the box which QueryError.Code may hold.
+const (
+	ErrCodeTupleNotFound = 0x31
+	ErrCodeNoSuchProc    = 0x32
+	ErrCodeTupleFound    = 0x37
+	ErrCodeNoSuchSpace   = 0x39
+)
+
 type QueryError struct {
 	error
+	// Code is the box error code, 0 for errors detected on the client side.
+	Code uint32
 }
 
 func NewConnectionError(message string) error {
@@ -32,3 +47,47 @@ func NewQueryError(message string) error {
 		error: errors.New(message),
 	}
 }
+
+// NewQueryErrorCode returns QueryError with the box error code, e.g. for servers speaking iproto.
+func NewQueryErrorCode(code uint32, message string) error {
+	return &QueryError{
+		error: errors.New(message),
+		Code:  code,
+	}
+}
+
+// newCausedError returns a copy of err (one of ConnectionError variables) which wraps cause.
+func newCausedError(err error, cause error) error {
+	if cause == nil {
+		return err
+	}
+	return &ConnectionError{
+		error: err.(*ConnectionError).error,
+		cause: cause,
+	}
+}
+
+func (e *ConnectionError) Error() string {
+	if e.cause != nil {
+		return e.error.Error() + ": " + e.cause.Error()
+	}
+	return e.error.Error()
+}
+
+// Unwrap returns the underlying cause of the error, if any.
+func (e *ConnectionError) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether e is the same kind of error as target, regardless of cause.
+// So errors.Is(err, ErrConnectionClosed) holds for every close reason.
+func (e *ConnectionError) Is(target error) bool {
+	t, ok := target.(*ConnectionError)
+	return ok && t.error == e.error
+}
+
+// isQueryErrorCode returns true if err is QueryError with given code.
+func isQueryErrorCode(err error, code uint32) bool {
+	queryErr, ok := err.(*QueryError)
+	return ok && queryErr.Code == code
+}
@@ -0,0 +1,452 @@
+// Package gateway maps HTTP/JSON requests onto tarantool 1.5 queries.
+//
+// Routes:
+//
+//	GET    /space/{id}[/{index}]?key=...&limit=...&offset=...  select, key is repeated for composite keys
+//	PUT    /space/{id}[?mode=add|replace]                        insert tuple given as JSON array
+//	PATCH  /space/{id}?key=...                                   update by operations given as JSON list
+//	DELETE /space/{id}?key=...                                   delete
+//	POST   /call/{proc}[?space={id}]                             call with arguments given as JSON array
+//
+// Tuples are JSON arrays of fields typed by the schema (see tnt.FieldType.Decode and tnt.FieldType.Encode),
+// replies are {"tuples": [...]}. Key values are parsed by tnt.ParseTypedField, e.g. key=42 or key=num:42.
+// Errors are replied as {"error": "...", "code": box_error_code}.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// Executor executes queries, e.g. *tnt.Connection or *tnt.Pool.
+type Executor interface {
+	Exec(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error)
+}
+
+const (
+	defaultSelectLimit = 100
+	maxRequestBody     = 16 << 20
+)
+
+// Handler is http.Handler serving the routes of the package.
+type Handler struct {
+	Conn Executor
+	// Schema describes spaces, fields of unknown spaces are strings (see tnt.Raw).
+	Schema *tnt.Schema
+	// DefaultLimit is the select limit if the request has none, 100 by default.
+	DefaultLimit uint32
+}
+
+// httpError is the error with HTTP status.
+type httpError struct {
+	status  int
+	message string
+	// allow is the Allow header of 405 reply
+	allow string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, v ...interface{}) error {
+	return &httpError{status: http.StatusBadRequest, message: fmt.Sprintf(format, v...)}
+}
+
+// StatusCode returns HTTP status for the error of Executor.
+func StatusCode(err error) int {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.status
+	}
+
+	var queryErr *tnt.QueryError
+	if errors.As(err, &queryErr) {
+		switch queryErr.Code {
+		case tnt.ErrCodeTupleNotFound, tnt.ErrCodeNoSuchSpace, tnt.ErrCodeNoSuchProc:
+			return http.StatusNotFound
+		case tnt.ErrCodeTupleFound:
+			return http.StatusConflict
+		}
+		return http.StatusBadRequest
+	}
+
+	switch {
+	case errors.Is(err, tnt.ErrRequestTimeout), errors.Is(err, tnt.ErrResponseTimeout),
+		errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, tnt.ErrTooManyRequests), errors.Is(err, tnt.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	}
+
+	var connErr *tnt.ConnectionError
+	if errors.As(err, &connErr) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tuples, err := h.serve(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tuples": tuples})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	reply := map[string]interface{}{"error": err.Error()}
+	var queryErr *tnt.QueryError
+	if errors.As(err, &queryErr) && queryErr.Code != 0 {
+		reply["code"] = queryErr.Code
+	}
+	var httpErr *httpError
+	if errors.As(err, &httpErr) && httpErr.allow != "" {
+		w.Header().Set("Allow", httpErr.allow)
+	}
+	writeJSON(w, StatusCode(err), reply)
+}
+
+func methodNotAllowed(allowed string) error {
+	return &httpError{http.StatusMethodNotAllowed, "Method not allowed", allowed}
+}
+
+// serve returns decoded tuples of the reply.
+func (h *Handler) serve(r *http.Request) ([][]interface{}, error) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(path) == 2 && path[0] == "call":
+		if r.Method != http.MethodPost {
+			return nil, methodNotAllowed(http.MethodPost)
+		}
+		return h.call(r, path[1])
+	case (len(path) == 2 || len(path) == 3) && path[0] == "space":
+		id, err := strconv.ParseUint(path[1], 10, 32)
+		if err != nil {
+			return nil, badRequest("Wrong space: %s", path[1])
+		}
+		space := h.space(uint32(id))
+
+		var index uint32
+		if len(path) == 3 {
+			n, err := strconv.ParseUint(path[2], 10, 32)
+			if err != nil {
+				return nil, badRequest("Wrong index: %s", path[2])
+			}
+			index = uint32(n)
+			if r.Method != http.MethodGet {
+				return nil, methodNotAllowed(http.MethodGet)
+			}
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			return h.selectTuples(r, space, index)
+		case http.MethodPut:
+			return h.insert(r, space)
+		case http.MethodPatch:
+			return h.update(r, space)
+		case http.MethodDelete:
+			return h.delete(r, space)
+		}
+		return nil, methodNotAllowed("GET, PUT, PATCH, DELETE")
+	}
+	return nil, &httpError{status: http.StatusNotFound, message: "Not found: " + r.URL.Path}
+}
+
+// space returns description of the space, the one without fields if the schema has none.
+func (h *Handler) space(id uint32) *tnt.SpaceConfig {
+	if space := h.Schema.Space(id); space != nil {
+		return space
+	}
+	return &tnt.SpaceConfig{ID: id}
+}
+
+func (h *Handler) exec(r *http.Request, space *tnt.SpaceConfig, q tnt.Query) ([][]interface{}, error) {
+	tuples, err := h.Conn.Exec(r.Context(), q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]interface{}, len(tuples))
+	for i, tuple := range tuples {
+		if rows[i], err = space.DecodeTuple(tuple); err != nil {
+			return nil, fmt.Errorf("Reply tuple %d: %s", i, err)
+		}
+	}
+	return rows, nil
+}
+
+// key parses key query parameters typed by index parts.
+func key(r *http.Request, space *tnt.SpaceConfig, index uint32, required bool) (tnt.Tuple, error) {
+	values := r.URL.Query()["key"]
+	if required && len(values) == 0 {
+		return nil, badRequest("Key is required")
+	}
+
+	types := space.KeyTypes(index)
+	key := make(tnt.Tuple, len(values))
+	for i, value := range values {
+		t := tnt.Raw
+		if i < len(types) {
+			t = types[i]
+		}
+		field, err := tnt.ParseTypedField(value, t)
+		if err != nil {
+			return nil, badRequest("Key part %d: %s", i, err)
+		}
+		key[i] = field
+	}
+	return key, nil
+}
+
+func uintParam(r *http.Request, name string, def uint32) (uint32, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, badRequest("Wrong %s: %s", name, s)
+	}
+	return uint32(n), nil
+}
+
+// decodeBody decodes JSON body keeping numbers as json.Number. Empty body is ok unless required.
+func decodeBody(r *http.Request, v interface{}, required bool) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required {
+			return badRequest("Body is required")
+		}
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("Wrong body: %s", err)
+	}
+	return nil
+}
+
+func (h *Handler) selectTuples(r *http.Request, space *tnt.SpaceConfig, index uint32) ([][]interface{}, error) {
+	key, err := key(r, space, index, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultLimit := h.DefaultLimit
+	if defaultLimit == 0 {
+		defaultLimit = defaultSelectLimit
+	}
+	limit, err := uintParam(r, "limit", defaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := uintParam(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.exec(r, space, &tnt.Select{
+		Space:  space.ID,
+		Index:  index,
+		Tuples: []tnt.Tuple{key},
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *Handler) insert(r *http.Request, space *tnt.SpaceConfig) ([][]interface{}, error) {
+	var mode tnt.InsertMode
+	switch m := r.URL.Query().Get("mode"); m {
+	case "":
+		mode = tnt.InsertOrReplace
+	case "add":
+		mode = tnt.InsertAdd
+	case "replace":
+		mode = tnt.InsertReplace
+	default:
+		return nil, badRequest("Unknown mode: %s", m)
+	}
+
+	var row []interface{}
+	if err := decodeBody(r, &row, true); err != nil {
+		return nil, err
+	}
+	tuple, err := space.EncodeTuple(row)
+	if err != nil {
+		return nil, badRequest("Wrong tuple: %s", err)
+	}
+
+	return h.exec(r, space, &tnt.Insert{Space: space.ID, Tuple: tuple, Mode: mode, ReturnTuple: true})
+}
+
+// operation is the JSON form of update operation. Field is the number or the name of field.
+// Op is one of set, add, and, xor, or, splice, delete, insert. Splice has offset and length.
+type operation struct {
+	Op     string      `json:"op"`
+	Field  interface{} `json:"field"`
+	Value  interface{} `json:"value"`
+	Offset int32       `json:"offset"`
+	Length int32       `json:"length"`
+}
+
+func fieldNo(space *tnt.SpaceConfig, field interface{}) (uint32, error) {
+	switch f := field.(type) {
+	case json.Number:
+		n, err := strconv.ParseUint(f.String(), 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return uint32(n), nil
+	case string:
+		for i, config := range space.Fields {
+			if config.Name == f {
+				return uint32(i), nil
+			}
+		}
+		return 0, fmt.Errorf("unknown field %q", f)
+	}
+	return 0, fmt.Errorf("field must be number or name, got %v", field)
+}
+
+func (op *operation) operator(space *tnt.SpaceConfig) (tnt.Operator, error) {
+	field, err := fieldNo(space, op.Field)
+	if err != nil {
+		return tnt.Operator{}, err
+	}
+
+	switch op.Op {
+	case "delete":
+		return tnt.OpDelete(field, nil), nil
+	case "splice":
+		value, ok := op.Value.(string)
+		if !ok {
+			return tnt.Operator{}, errors.New("splice value must be string")
+		}
+		return tnt.OpSplice(field, op.Offset, op.Length, tnt.Bytes(value)), nil
+	}
+
+	t := space.FieldType(int(field))
+	switch op.Op {
+	case "add", "and", "xor", "or":
+		// arithmetic is defined for numbers only
+		if t != tnt.Num && t != tnt.Num64 {
+			t = tnt.Num
+		}
+	case "set", "insert":
+		// pass
+	default:
+		return tnt.Operator{}, fmt.Errorf("unknown op %q", op.Op)
+	}
+
+	value, err := t.Encode(op.Value)
+	if err != nil {
+		return tnt.Operator{}, err
+	}
+
+	switch op.Op {
+	case "add":
+		return tnt.OpAdd(field, value), nil
+	case "and":
+		return tnt.OpAnd(field, value), nil
+	case "xor":
+		return tnt.OpXor(field, value), nil
+	case "or":
+		return tnt.OpOr(field, value), nil
+	case "insert":
+		return tnt.OpInsert(field, value), nil
+	}
+	return tnt.OpSet(field, value), nil
+}
+
+func (h *Handler) update(r *http.Request, space *tnt.SpaceConfig) ([][]interface{}, error) {
+	key, err := key(r, space, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []operation
+	if err := decodeBody(r, &ops, true); err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, badRequest("Operations are required")
+	}
+
+	q := &tnt.Update{Space: space.ID, Tuple: key, ReturnTuple: true}
+	for i := range ops {
+		op, err := ops[i].operator(space)
+		if err != nil {
+			return nil, badRequest("Operation %d: %s", i, err)
+		}
+		q.Ops = append(q.Ops, op)
+	}
+
+	rows, err := h.exec(r, space, q)
+	if err == nil && len(rows) == 0 {
+		return nil, &httpError{status: http.StatusNotFound, message: "Tuple not found"}
+	}
+	return rows, err
+}
+
+func (h *Handler) delete(r *http.Request, space *tnt.SpaceConfig) ([][]interface{}, error) {
+	key, err := key(r, space, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.exec(r, space, &tnt.Delete{Space: space.ID, Tuple: key, ReturnTuple: true})
+	if err == nil && len(rows) == 0 {
+		return nil, &httpError{status: http.StatusNotFound, message: "Tuple not found"}
+	}
+	return rows, err
+}
+
+// call passes arguments as strings unless they are typed, e.g. "num:42". Reply is decoded by space parameter.
+func (h *Handler) call(r *http.Request, proc string) ([][]interface{}, error) {
+	if proc == "" {
+		return nil, badRequest("Procedure name is required")
+	}
+
+	space := &tnt.SpaceConfig{}
+	if r.URL.Query().Get("space") != "" {
+		id, err := uintParam(r, "space", 0)
+		if err != nil {
+			return nil, err
+		}
+		space = h.space(id)
+	}
+
+	var args []interface{}
+	if err := decodeBody(r, &args, false); err != nil {
+		return nil, err
+	}
+	tuple, err := (&tnt.SpaceConfig{}).EncodeTuple(args)
+	if err != nil {
+		return nil, badRequest("Wrong arguments: %s", err)
+	}
+
+	return h.exec(r, space, &tnt.Call{Name: tnt.Bytes(proc), Tuple: tuple, ReturnTuple: true})
+}
@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/stretchr/testify/assert"
+)
+
+// executorFunc is the function implementing Executor.
+type executorFunc func(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error)
+
+func (f executorFunc) Exec(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+	return f(ctx, q)
+}
+
+var testSchema = &tnt.Schema{Spaces: []tnt.SpaceConfig{{
+	ID:     1,
+	Fields: []tnt.FieldConfig{{Name: "id", Type: tnt.Num}, {Name: "name", Type: tnt.Str}, {Name: "balance", Type: tnt.Num64}},
+	Indexes: []tnt.IndexConfig{
+		{Type: tnt.Hash, Unique: true, Parts: []tnt.Part{{Field: 0, Type: tnt.Num}}},
+		{Type: tnt.Tree, Parts: []tnt.Part{{Field: 1, Type: tnt.Str}}},
+	},
+}}}
+
+func do(h http.Handler, method string, url string, body string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+	var reply map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	return w.Code, reply
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var last tnt.Query
+	tuple := tnt.Tuple{tnt.PackInt(1), tnt.Bytes("bob"), tnt.PackLong(100)}
+	h := &Handler{
+		Schema: testSchema,
+		Conn: executorFunc(func(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+			last = q
+			if d, ok := q.(*tnt.Delete); ok && string(d.Tuple[0]) == string(tnt.PackInt(2)) {
+				return nil, nil
+			}
+			if _, ok := q.(*tnt.Call); ok {
+				return []tnt.Tuple{{tnt.Bytes("ok"), {0xff}}}, nil
+			}
+			return []tnt.Tuple{tuple}, nil
+		}),
+	}
+
+	expected := []interface{}{[]interface{}{float64(1), "bob", float64(100)}}
+
+	status, reply := do(h, "GET", "/space/1/1?key=bob&limit=10&offset=5", "")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(expected, reply["tuples"])
+	assert.Equal(&tnt.Select{Space: uint32(1), Index: 1, Tuples: []tnt.Tuple{{tnt.Bytes("bob")}}, Limit: 10, Offset: 5}, last)
+
+	status, _ = do(h, "GET", "/space/1?key=7", "")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(&tnt.Select{Space: uint32(1), Tuples: []tnt.Tuple{{tnt.PackInt(7)}}, Limit: defaultSelectLimit}, last)
+
+	status, reply = do(h, "PUT", "/space/1?mode=add", `[1, "bob", 100]`)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(expected, reply["tuples"])
+	assert.Equal(&tnt.Insert{Space: uint32(1), Tuple: tuple, Mode: tnt.InsertAdd, ReturnTuple: true}, last)
+
+	status, _ = do(h, "PATCH", "/space/1?key=1", `[
+		{"op": "set", "field": "name", "value": "alice"},
+		{"op": "add", "field": 2, "value": 5},
+		{"op": "splice", "field": 1, "offset": 0, "length": 1, "value": "A"},
+		{"op": "delete", "field": 3}
+	]`)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(&tnt.Update{Space: uint32(1), Tuple: tnt.Tuple{tnt.PackInt(1)}, ReturnTuple: true, Ops: []tnt.Operator{
+		tnt.OpSet(1, tnt.Bytes("alice")),
+		tnt.OpAdd(2, tnt.PackLong(5)),
+		tnt.OpSplice(1, 0, 1, tnt.Bytes("A")),
+		tnt.OpDelete(3, nil),
+	}}, last)
+
+	status, _ = do(h, "DELETE", "/space/1?key=1", "")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(&tnt.Delete{Space: uint32(1), Tuple: tnt.Tuple{tnt.PackInt(1)}, ReturnTuple: true}, last)
+
+	status, _ = do(h, "DELETE", "/space/1?key=2", "")
+	assert.Equal(http.StatusNotFound, status)
+
+	status, reply = do(h, "POST", "/call/box.select", `["1", 0, "num:42"]`)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal([]interface{}{[]interface{}{"ok", "hex:ff"}}, reply["tuples"])
+	assert.Equal(&tnt.Call{Name: tnt.Bytes("box.select"), Tuple: tnt.Tuple{tnt.Bytes("1"), tnt.Bytes("0"), tnt.PackInt(42)}, ReturnTuple: true}, last)
+
+	status, _ = do(h, "POST", "/call/proc", "")
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(&tnt.Call{Name: tnt.Bytes("proc"), Tuple: tnt.Tuple{}, ReturnTuple: true}, last)
+
+	// unknown space has string fields
+	status, _ = do(h, "PUT", "/space/5", `["a", 1]`)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(&tnt.Insert{Space: uint32(5), Tuple: tnt.Tuple{tnt.Bytes("a"), tnt.Bytes("1")}, ReturnTuple: true}, last)
+}
+
+func TestHandlerBadRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	h := &Handler{
+		Schema: testSchema,
+		Conn: executorFunc(func(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+			return nil, nil
+		}),
+	}
+
+	cases := []struct {
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{"GET", "/", "", http.StatusNotFound},
+		{"GET", "/space/x", "", http.StatusBadRequest},
+		{"GET", "/space/1/x", "", http.StatusBadRequest},
+		{"GET", "/space/1?key=x", "", http.StatusBadRequest},
+		{"GET", "/space/1?limit=-1", "", http.StatusBadRequest},
+		{"POST", "/space/1", "", http.StatusMethodNotAllowed},
+		{"PUT", "/space/1/0", "[]", http.StatusMethodNotAllowed},
+		{"GET", "/call/proc", "", http.StatusMethodNotAllowed},
+		{"PUT", "/space/1", "", http.StatusBadRequest},
+		{"PUT", "/space/1", "{", http.StatusBadRequest},
+		{"PUT", "/space/1", `["x"]`, http.StatusBadRequest},
+		{"PUT", "/space/1?mode=upsert", `[1]`, http.StatusBadRequest},
+		{"PATCH", "/space/1", `[{"op": "set", "field": 1, "value": "x"}]`, http.StatusBadRequest},
+		{"PATCH", "/space/1?key=1", `[]`, http.StatusBadRequest},
+		{"PATCH", "/space/1?key=1", `[{"op": "mul", "field": 1, "value": 2}]`, http.StatusBadRequest},
+		{"PATCH", "/space/1?key=1", `[{"op": "set", "field": "missing", "value": 2}]`, http.StatusBadRequest},
+		{"PATCH", "/space/1?key=1", `[{"op": "set", "field": 1, "value": "x"}]`, http.StatusNotFound},
+		{"DELETE", "/space/1", "", http.StatusBadRequest},
+		{"POST", "/call/proc", `[true]`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		status, reply := do(h, c.method, c.url, c.body)
+		assert.Equal(c.status, status, "%s %s %s", c.method, c.url, c.body)
+		assert.NotEmpty(reply["error"], "%s %s %s", c.method, c.url, c.body)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/space/1", nil))
+	assert.Equal("GET, PUT, PATCH, DELETE", w.Header().Get("Allow"))
+}
+
+func TestStatusCode(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{tnt.NewQueryErrorCode(tnt.ErrCodeTupleNotFound, "not found"), http.StatusNotFound},
+		{tnt.NewQueryErrorCode(tnt.ErrCodeNoSuchSpace, "no space"), http.StatusNotFound},
+		{tnt.NewQueryErrorCode(tnt.ErrCodeNoSuchProc, "no proc"), http.StatusNotFound},
+		{tnt.NewQueryErrorCode(tnt.ErrCodeTupleFound, "duplicate"), http.StatusConflict},
+		{tnt.NewQueryErrorCode(0x02, "illegal params"), http.StatusBadRequest},
+		{tnt.ErrResponseTimeout, http.StatusGatewayTimeout},
+		{tnt.ErrRequestTimeout, http.StatusGatewayTimeout},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{tnt.ErrTooManyRequests, http.StatusServiceUnavailable},
+		{tnt.ErrCircuitOpen, http.StatusServiceUnavailable},
+		{tnt.ErrConnectionClosed, http.StatusBadGateway},
+		{fmt.Errorf("wrapped: %w", tnt.ErrConnectionClosed), http.StatusBadGateway},
+		{errors.New("other"), http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		assert.Equal(c.status, StatusCode(c.err), "%v", c.err)
+	}
+
+	h := &Handler{Conn: executorFunc(func(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+		return nil, tnt.NewQueryErrorCode(tnt.ErrCodeTupleFound, "Duplicate key exists")
+	})}
+	status, reply := do(h, "PUT", "/space/1", `["a"]`)
+	assert.Equal(http.StatusConflict, status)
+	assert.Equal("Duplicate key exists", reply["error"])
+	assert.Equal(float64(tnt.ErrCodeTupleFound), reply["code"])
+}
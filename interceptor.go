@@ -0,0 +1,75 @@
+package tnt
+
+import (
+	"context"
+)
+
+// Invoker does the query. Interceptor calls it to pass the query further along the chain.
+type Invoker func(ctx context.Context, q Query) ([]Tuple, error)
+
+// Interceptor wraps query execution, e.g. for metrics, logging or retries.
+// It does the query by next or returns without calling it. Context has no deadline
+// if query is done without timeout (Execute), then Options.QueryTimeout is applied.
+type Interceptor func(ctx context.Context, q Query, next Invoker) ([]Tuple, error)
+
+// chainInterceptors returns invoker which passes queries through interceptors in order, the first is the outermost.
+func chainInterceptors(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, q Query) ([]Tuple, error) {
+			return interceptor(ctx, q, next)
+		}
+	}
+	return invoker
+}
+
+// executor implements query methods of IConnection (memcache ones as well) over invoker
+// wrapped by interceptors. So interceptors of Connection, Connector and Pool see all the queries.
+type executor struct {
+	memcache
+	invoke Invoker
+}
+
+func (e *executor) init(opts *Options, invoker Invoker) {
+	var interceptors []Interceptor
+	var memcacheSpace interface{} = uint32(23)
+	if opts != nil {
+		interceptors = opts.Interceptors[:len(opts.Interceptors):len(opts.Interceptors)]
+		if opts.Retry != nil {
+			interceptors = append(interceptors, RetryInterceptor(*opts.Retry))
+		}
+		if opts.CircuitBreaker != nil {
+			interceptors = append(interceptors, opts.CircuitBreaker.Interceptor())
+		}
+		if opts.MemcacheSpace != nil {
+			memcacheSpace = opts.MemcacheSpace
+		}
+	}
+	e.invoke = chainInterceptors(interceptors, invoker)
+	e.memcache.init(e.Execute, memcacheSpace)
+}
+
+// Exec does the q query with context. Query timeout is the context deadline or Options.QueryTimeout.
+func (e *executor) Exec(ctx context.Context, q Query) ([]Tuple, error) {
+	return e.invoke(ctx, q)
+}
+
+func (e *executor) ExecuteOptions(q Query, opts *QueryOptions) ([]Tuple, error) {
+	ctx := context.Background()
+	if opts != nil && opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if opts != nil && opts.Idempotent {
+		ctx = WithIdempotent(ctx)
+	}
+	if opts != nil && opts.HedgeDelay != 0 {
+		ctx = WithHedgeDelay(ctx, opts.HedgeDelay)
+	}
+	return e.invoke(ctx, q)
+}
+
+func (e *executor) Execute(q Query) ([]Tuple, error) {
+	return e.ExecuteOptions(q, nil)
+}
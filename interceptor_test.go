@@ -0,0 +1,99 @@
+package tnt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queryLog is an interceptor which records queries by name
+type queryLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *queryLog) interceptor(name string) Interceptor {
+	return func(ctx context.Context, q Query, next Invoker) ([]Tuple, error) {
+		l.mu.Lock()
+		l.entries = append(l.entries, fmt.Sprintf("%s %T", name, q))
+		l.mu.Unlock()
+		return next(ctx, q)
+	}
+}
+
+func (l *queryLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := l.entries
+	l.entries = nil
+	return entries
+}
+
+func TestInterceptors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+	go fakeServer(listener, memcacheSpaceHandler())
+
+	log := &queryLog{}
+	errDenied := errors.New("denied")
+	var deadline time.Time
+	opts := &Options{Interceptors: []Interceptor{
+		log.interceptor("outer"),
+		func(ctx context.Context, q Query, next Invoker) ([]Tuple, error) {
+			if _, ok := q.(*Call); ok {
+				return nil, errDenied
+			}
+			deadline, _ = ctx.Deadline()
+			return next(ctx, q)
+		},
+		log.interceptor("inner"),
+	}}
+
+	conn, err := Connect(listener.Addr().String(), opts)
+	require.NoError(err)
+	defer conn.Close()
+
+	_, err = conn.ExecuteOptions(&Select{Value: Bytes("key")}, &QueryOptions{Timeout: time.Minute})
+	assert.NoError(err)
+	assert.Equal([]string{"outer *tnt.Select", "inner *tnt.Select"}, log.take())
+	assert.WithinDuration(time.Now().Add(time.Minute), deadline, time.Second)
+
+	// query isn't sent if interceptor returns without next
+	_, err = conn.Exec(context.Background(), &Call{Name: Bytes("box.info")})
+	assert.Equal(errDenied, err)
+	assert.Equal([]string{"outer *tnt.Call"}, log.take())
+
+	// memcache methods are intercepted
+	assert.NoError(conn.MemSet("key", []byte("value"), 0))
+	value, err := conn.MemGet("key")
+	assert.NoError(err)
+	assert.Equal([]byte("value"), value)
+	assert.Equal([]string{"outer *tnt.Insert", "inner *tnt.Insert", "outer *tnt.Select", "inner *tnt.Select"}, log.take())
+
+	// connector and pool run interceptors once, not per connection
+	connector := New(listener.Addr().String(), opts)
+	defer connector.Close()
+	value, err = connector.MemGet("key")
+	assert.NoError(err)
+	assert.Equal([]byte("value"), value)
+	assert.Equal([]string{"outer *tnt.Select", "inner *tnt.Select"}, log.take())
+
+	pool := NewPool(listener.Addr().String(), 2, opts)
+	defer pool.Close()
+	for i := 0; i < 2; i++ {
+		_, err = pool.Execute(&Select{Value: Bytes("key")})
+		assert.NoError(err)
+	}
+	assert.Equal([]string{"outer *tnt.Select", "inner *tnt.Select", "outer *tnt.Select", "inner *tnt.Select"}, log.take())
+}
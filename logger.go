@@ -0,0 +1,11 @@
+package tnt
+
+// Logger is the interface used by Connection to report internal errors.
+// *log.Logger from the standard library satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
@@ -1,17 +1,114 @@
 package tnt
 
 import (
-	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
-func (conn *Connection) MemGet(key string) ([]byte, error) {
+// memcacheMultiChunk is the max number of keys in a single request of MemGetMulti
+// and the max number of concurrent requests of MemDeleteMulti.
+const memcacheMultiChunk = 256
+
+// MemItem is an item of the memcache space.
+// Tuple layout is the same as the box memcached port uses: key, meta, suffix and value,
+// where meta is packed expires, flags and CAS, and suffix is " <flags> <bytes>\r\n".
+type MemItem struct {
+	Value []byte
+	Flags uint32
+	// Expires is unix time of item expiration, 0 means never.
+	Expires uint32
+	CAS     uint64
+}
+
+var errMemTuple = errors.New("Wrong memcache tuple")
+
+func packMemItem(key string, value []byte, flags uint32, expires uint32, cas uint64) Tuple {
+	// WTF? See BenchmarkConcatBytes*
+	b1 := PackInt(expires)
+	b2 := PackInt(flags)
+	b3 := PackLong(cas)
+	metaInfo := []byte{
+		b1[0], b1[1], b1[2], b1[3],
+		b2[0], b2[1], b2[2], b2[3],
+		b3[0], b3[1], b3[2], b3[3],
+		b3[4], b3[5], b3[6], b3[7],
+	}
+
+	return Tuple{
+		[]byte(key),
+		metaInfo,
+		[]byte(" " + strconv.FormatUint(uint64(flags), 10) + " " + strconv.Itoa(len(value)) + "\r\n"),
+		value,
+	}
+}
+
+// unpackMemItem returns nil if item has expired at the now moment.
+func unpackMemItem(tuple Tuple, now time.Time) (*MemItem, error) {
+	if len(tuple) < 4 || len(tuple[1]) != 16 {
+		return nil, &QueryError{error: errMemTuple}
+	}
+
+	item := &MemItem{
+		Value:   tuple[3],
+		Expires: UnpackInt(tuple[1][0:4]),
+		Flags:   UnpackInt(tuple[1][4:8]),
+		CAS:     UnpackLong(tuple[1][8:16]),
+	}
+
+	// the same check as box memcached does
+	if item.Expires != 0 && int64(item.Expires) < now.Unix() {
+		return nil, nil
+	}
+
+	return item, nil
+}
+
+// memcache implements IMemcache by queries to the memcache space.
+type memcache struct {
+	cas   uint64 // first to be 64-bit aligned for atomic
+	space interface{}
+	exec  func(q Query) ([]Tuple, error)
+}
+
+// NewMemcache returns IMemcache which does queries to the memcache space by exec,
+// e.g. for wrappers and fakes of IConnection.
+func NewMemcache(exec func(q Query) ([]Tuple, error), space interface{}) IMemcache {
+	m := &memcache{}
+	m.init(exec, space)
+	return m
+}
+
+func (m *memcache) init(exec func(q Query) ([]Tuple, error), space interface{}) {
+	m.exec = exec
+	m.space = space
+	// CAS values of different connections shouldn't collide
+	atomic.StoreUint64(&m.cas, uint64(time.Now().UnixNano()))
+}
+
+func (m *memcache) nextCas() uint64 {
+	return atomic.AddUint64(&m.cas, 1)
+}
+
+func (m *memcache) MemGet(key string) ([]byte, error) {
+	item, err := m.MemGetItem(key)
+	if item == nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+// MemGetItem returns nil if key is missing or expired.
+func (m *memcache) MemGetItem(key string) (*MemItem, error) {
 	req := &Select{
 		Value: []byte(key),
-		Space: conn.memcacheSpace,
+		Space: m.space,
 	}
 
-	res, err := conn.Execute(req)
+	res, err := m.exec(req)
 
 	if err != nil {
 		return nil, err
@@ -21,46 +118,230 @@ func (conn *Connection) MemGet(key string) ([]byte, error) {
 		return nil, nil
 	}
 
-	return res[0][3], nil
+	return unpackMemItem(res[0], time.Now())
 }
 
-func (conn *Connection) MemSet(key string, value []byte, expires uint32) error {
-	// type memcacheMetaInfo struct {
-	//     expires uint32
-	//     flags   uint32
-	//     cas     uint64
-	// }
+// MemGetMulti returns values of found keys. Missing and expired keys are absent in the result.
+func (m *memcache) MemGetMulti(keys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+	now := time.Now()
 
-	cas := atomic.AddUint64(&conn.memcacheCas, 1)
+	for start := 0; start < len(keys); start += memcacheMultiChunk {
+		end := start + memcacheMultiChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
 
-	// WTF? See BenchmarkConcatBytes*
-	b1 := PackInt(expires)
-	b3 := PackLong(cas)
-	metaInfo := []byte{
-		b1[0], b1[1], b1[2], b1[3],
-		0x0, 0x0, 0x0, 0x0,
-		b3[0], b3[1], b3[2], b3[3],
-		b3[4], b3[5], b3[6], b3[7],
-	}
+		values := make([]Bytes, end-start)
+		for i, key := range keys[start:end] {
+			values[i] = Bytes(key)
+		}
 
-	data := Tuple{
-		[]byte(key),
-		metaInfo,
-		[]byte(fmt.Sprintf(" 0 %d\r\n", len(value))), // @TODO: benchmark
-		value,
+		res, err := m.exec(&Select{
+			Values: values,
+			Space:  m.space,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tuple := range res {
+			item, err := unpackMemItem(tuple, now)
+			if err != nil {
+				return nil, err
+			}
+			if item != nil {
+				result[string(tuple[0])] = item.Value
+			}
+		}
 	}
 
-	_, err := conn.Execute(&Insert{
-		Space: conn.memcacheSpace,
-		Tuple: data,
+	return result, nil
+}
+
+func (m *memcache) MemSet(key string, value []byte, expires uint32) error {
+	return m.MemSetItem(key, &MemItem{
+		Value:   value,
+		Expires: expires,
+	})
+}
+
+// MemSetItem stores item with its flags and expiration. New CAS is assigned, item.CAS is ignored.
+func (m *memcache) MemSetItem(key string, item *MemItem) error {
+	_, err := m.exec(&Insert{
+		Space: m.space,
+		Tuple: packMemItem(key, item.Value, item.Flags, item.Expires, m.nextCas()),
 	})
 
 	return err
 }
 
-func (conn *Connection) MemDelete(key string) error {
-	_, err := conn.Execute(&Delete{
-		Space: conn.memcacheSpace,
+// memReplace stores new value of the existing item with flags and expiration of item.
+// It returns false if item has been deleted meanwhile. Concurrent writes aren't detected, see IMemcache.
+func (m *memcache) memReplace(key string, value []byte, item *MemItem) (bool, error) {
+	_, err := m.exec(&Insert{
+		Space: m.space,
+		Tuple: packMemItem(key, value, item.Flags, item.Expires, m.nextCas()),
+		Mode:  InsertReplace,
+	})
+
+	if isQueryErrorCode(err, ErrCodeTupleNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MemCAS stores value with expiration like MemSet, but only if CAS of the key is equal to cas.
+// It returns false if key is missing or CAS doesn't match.
+// CAS is compared by the client, not the box: a write between the compare and the replace
+// is silently overwritten. Use MemcacheClient for atomic CAS.
+func (m *memcache) MemCAS(key string, value []byte, expires uint32, cas uint64) (bool, error) {
+	item, err := m.MemGetItem(key)
+	if err != nil || item == nil || item.CAS != cas {
+		return false, err
+	}
+
+	return m.memReplace(key, value, &MemItem{
+		Expires: expires,
+	})
+}
+
+// MemAdd stores value only if the key is missing or expired.
+// Expired item is overwritten by a separate request, concurrent MemAdd may succeed as well.
+func (m *memcache) MemAdd(key string, value []byte, expires uint32) (bool, error) {
+	tuple := packMemItem(key, value, 0, expires, m.nextCas())
+	_, err := m.exec(&Insert{
+		Space: m.space,
+		Tuple: tuple,
+		Mode:  InsertAdd,
+	})
+
+	if !isQueryErrorCode(err, ErrCodeTupleFound) {
+		return err == nil, err
+	}
+
+	// expired item is the same as missing one
+	item, err := m.MemGetItem(key)
+	if err != nil || item != nil {
+		return false, err
+	}
+
+	_, err = m.exec(&Insert{
+		Space: m.space,
+		Tuple: tuple,
+	})
+	return err == nil, err
+}
+
+// MemReplace stores value only if the key exists.
+func (m *memcache) MemReplace(key string, value []byte, expires uint32) (bool, error) {
+	item, err := m.MemGetItem(key)
+	if err != nil || item == nil {
+		return false, err
+	}
+
+	return m.memReplace(key, value, &MemItem{
+		Expires: expires,
+	})
+}
+
+// MemAppend adds value after the existing one. It returns false if the key is missing.
+// It isn't atomic: a concurrent write to the key may be lost, see IMemcache.
+func (m *memcache) MemAppend(key string, value []byte) (bool, error) {
+	item, err := m.MemGetItem(key)
+	if err != nil || item == nil {
+		return false, err
+	}
+
+	newValue := make([]byte, 0, len(item.Value)+len(value))
+	newValue = append(newValue, item.Value...)
+	newValue = append(newValue, value...)
+
+	return m.memReplace(key, newValue, item)
+}
+
+// MemPrepend adds value before the existing one. It returns false if the key is missing.
+// Like MemAppend, it isn't atomic.
+func (m *memcache) MemPrepend(key string, value []byte) (bool, error) {
+	item, err := m.MemGetItem(key)
+	if err != nil || item == nil {
+		return false, err
+	}
+
+	newValue := make([]byte, 0, len(item.Value)+len(value))
+	newValue = append(newValue, value...)
+	newValue = append(newValue, item.Value...)
+
+	return m.memReplace(key, newValue, item)
+}
+
+var errMemNonNumeric = errors.New("Cannot increment or decrement non-numeric value")
+
+// memIncr changes decimal value of the key like memcached does:
+// increment wraps around 64 bits, decrement stops at 0.
+func (m *memcache) memIncr(key string, delta uint64, decr bool) (uint64, bool, error) {
+	item, err := m.MemGetItem(key)
+	if err != nil || item == nil {
+		return 0, false, err
+	}
+
+	value, err := strconv.ParseUint(strings.TrimRight(string(item.Value), " "), 10, 64)
+	if err != nil {
+		return 0, false, &QueryError{error: errMemNonNumeric}
+	}
+
+	switch {
+	case !decr:
+		value += delta
+	case delta > value:
+		value = 0
+	default:
+		value -= delta
+	}
+
+	stored, err := m.memReplace(key, []byte(strconv.FormatUint(value, 10)), item)
+	if !stored {
+		return 0, false, err
+	}
+	return value, true, nil
+}
+
+// MemIncr increments decimal value of the key by delta and returns the new value.
+// It returns false if the key is missing. Concurrent increments may be lost,
+// use MemcacheClient for counters changed by several clients.
+func (m *memcache) MemIncr(key string, delta uint64) (uint64, bool, error) {
+	return m.memIncr(key, delta, false)
+}
+
+// MemDecr decrements decimal value of the key by delta and returns the new value.
+// It returns false if the key is missing. Like MemIncr, it isn't atomic.
+func (m *memcache) MemDecr(key string, delta uint64) (uint64, bool, error) {
+	return m.memIncr(key, delta, true)
+}
+
+// MemTouch changes expiration of the key keeping its value and CAS.
+// It returns false if the key is missing. Value written concurrently may be replaced by the old one.
+func (m *memcache) MemTouch(key string, expires uint32) (bool, error) {
+	item, err := m.MemGetItem(key)
+	if err != nil || item == nil {
+		return false, err
+	}
+
+	_, err = m.exec(&Insert{
+		Space: m.space,
+		Tuple: packMemItem(key, item.Value, item.Flags, expires, item.CAS),
+		Mode:  InsertReplace,
+	})
+
+	if isQueryErrorCode(err, ErrCodeTupleNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *memcache) MemDelete(key string) error {
+	_, err := m.exec(&Delete{
+		Space: m.space,
 		Tuple: Tuple{
 			[]byte(key),
 		},
@@ -68,3 +349,37 @@ func (conn *Connection) MemDelete(key string) error {
 
 	return err
 }
+
+// MemDeleteMulti sends deletes of all the keys without waiting for each reply.
+// It returns the first error occurred.
+func (m *memcache) MemDeleteMulti(keys []string) error {
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	for start := 0; start < len(keys); start += memcacheMultiChunk {
+		end := start + memcacheMultiChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		wg.Add(end - start)
+		for _, key := range keys[start:end] {
+			go func(key string) {
+				if err := m.MemDelete(key); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+					})
+				}
+				wg.Done()
+			}(key)
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return firstErr
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,10 @@ package tnt
 
 import (
 	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -46,3 +50,311 @@ func TestMem(t *testing.T) {
 	assert.NoError(err)
 	assert.Nil(data)
 }
+
+func TestMemItemPack(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1454021951, 0)
+	tuple := packMemItem("key", []byte("hello"), 42, 1454021951, 100500)
+	assert.Equal(Bytes("key"), tuple[0])
+	assert.Equal(Bytes(" 42 5\r\n"), tuple[2])
+
+	item, err := unpackMemItem(tuple, now)
+	assert.NoError(err)
+	assert.Equal(&MemItem{Value: []byte("hello"), Flags: 42, Expires: 1454021951, CAS: 100500}, item)
+
+	// expired
+	item, err = unpackMemItem(tuple, now.Add(time.Second))
+	assert.NoError(err)
+	assert.Nil(item)
+
+	// never expires
+	item, err = unpackMemItem(packMemItem("key", []byte("hello"), 0, 0, 1), now)
+	assert.NoError(err)
+	assert.NotNil(item)
+
+	_, err = unpackMemItem(Tuple{Bytes("key"), Bytes("meta")}, now)
+	assert.IsType(&QueryError{}, err)
+}
+
+func TestMemItem(t *testing.T) {
+	assert := assert.New(t)
+
+	primaryPort, tearDown := setUp(t)
+	if t.Skipped() {
+		return
+	}
+	defer tearDown()
+
+	conn, err := Connect(fmt.Sprintf("127.0.0.1:%d", primaryPort), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	key := fmt.Sprintf("item_%d", time.Now().UnixNano())
+	expires := uint32(time.Now().Add(time.Hour).Unix())
+
+	err = conn.MemSetItem(key, &MemItem{Value: []byte("hello"), Flags: 7, Expires: expires})
+	assert.NoError(err)
+
+	item, err := conn.MemGetItem(key)
+	assert.NoError(err)
+	if !assert.NotNil(item) {
+		return
+	}
+	assert.Equal([]byte("hello"), item.Value)
+	assert.Equal(uint32(7), item.Flags)
+	assert.Equal(expires, item.Expires)
+
+	// cas mismatch
+	stored, err := conn.MemCAS(key, []byte("world"), expires, item.CAS+1)
+	assert.NoError(err)
+	assert.False(stored)
+
+	stored, err = conn.MemCAS(key, []byte("world"), expires, item.CAS)
+	assert.NoError(err)
+	assert.True(stored)
+
+	item, err = conn.MemGetItem(key)
+	assert.NoError(err)
+	if assert.NotNil(item) {
+		assert.Equal([]byte("world"), item.Value)
+		assert.Equal(expires, item.Expires)
+	}
+
+	// expired item is missing
+	err = conn.MemSet(key, []byte("hello"), uint32(time.Now().Add(-time.Hour).Unix()))
+	assert.NoError(err)
+
+	data, err := conn.MemGet(key)
+	assert.NoError(err)
+	assert.Nil(data)
+
+	stored, err = conn.MemCAS(key, []byte("world"), expires, item.CAS)
+	assert.NoError(err)
+	assert.False(stored)
+}
+
+func TestMemGetMulti(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	var selects int32
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		assert.Equal(uint32(requestTypeSelect), requestType)
+		atomic.AddInt32(&selects, 1)
+
+		var tuples []Tuple
+		count := int(UnpackInt(body[16:20]))
+		offset := 20
+		for i := 0; i < count; i++ {
+			l, n, _ := unpackIntBase128(body[offset+4:])
+			key := string(body[offset+4+n : offset+4+n+int(l)])
+			offset += 4 + n + int(l)
+			if strings.HasPrefix(key, "hit") {
+				tuples = append(tuples, packMemItem(key, []byte("value_"+key), 0, 0, 1))
+			}
+		}
+		return tuplesReply(tuples...)
+	})
+
+	conn, err := Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	var keys []string
+	for i := 0; i < memcacheMultiChunk+10; i++ {
+		keys = append(keys, fmt.Sprintf("hit_%d", i), fmt.Sprintf("miss_%d", i))
+	}
+
+	data, err := conn.MemGetMulti(keys)
+	assert.NoError(err)
+	assert.Equal(int32(3), atomic.LoadInt32(&selects))
+	assert.Len(data, memcacheMultiChunk+10)
+	assert.Equal([]byte("value_hit_3"), data["hit_3"])
+
+	data, err = conn.MemGetMulti(nil)
+	assert.NoError(err)
+	assert.Empty(data)
+	assert.Equal(int32(3), atomic.LoadInt32(&selects))
+}
+
+func TestMemDeleteMulti(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	var deletes int32
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		assert.Equal(uint32(requestTypeDelete), requestType)
+		if atomic.AddInt32(&deletes, 1) == 5 {
+			return append(PackInt(0x3102), []byte("Tuple doesn't exist in index 0\x00")...)
+		}
+		return emptyReply
+	})
+
+	conn, err := Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key_%d", i)
+	}
+
+	err = conn.MemDeleteMulti(keys)
+	assert.IsType(&QueryError{}, err)
+	assert.Equal(int32(10), atomic.LoadInt32(&deletes))
+}
+
+// memcacheSpaceHandler is a fakeServer handler which keeps the memcache space in memory
+func memcacheSpaceHandler() func(requestType uint32, body []byte) []byte {
+	var mu sync.Mutex
+	data := make(map[string]Tuple)
+
+	errorReply := func(code uint32, message string) []byte {
+		return append(PackInt(code<<8|2), []byte(message+"\x00")...)
+	}
+
+	return func(requestType uint32, body []byte) []byte {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch requestType {
+		case requestTypeSelect:
+			var tuples []Tuple
+			offset := 20
+			for i := 0; i < int(UnpackInt(body[16:20])); i++ {
+				key, _ := unpackTuple(body[offset:])
+				offset += len(packTuple(key))
+				if tuple, exists := data[string(key[0])]; exists {
+					tuples = append(tuples, tuple)
+				}
+			}
+			return tuplesReply(tuples...)
+		case requestTypeInsert:
+			mode := InsertMode(UnpackInt(body[4:8]))
+			tuple, _ := unpackTuple(body[8:])
+			key := string(tuple[0])
+			_, exists := data[key]
+			if mode == InsertAdd && exists {
+				return errorReply(ErrCodeTupleFound, "Duplicate key exists in unique index 0")
+			}
+			if mode == InsertReplace && !exists {
+				return errorReply(ErrCodeTupleNotFound, "Tuple doesn't exist in index 0")
+			}
+			data[key] = tuple
+			return tuplesReply()
+		case requestTypeDelete:
+			key, _ := unpackTuple(body[8:])
+			delete(data, string(key[0]))
+			return tuplesReply()
+		}
+		return errorReply(1, "Unsupported request")
+	}
+}
+
+func TestMemOperations(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go fakeServer(listener, memcacheSpaceHandler())
+
+	conn, err := Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	expired := uint32(time.Now().Add(-time.Hour).Unix())
+
+	// add
+	stored, err := conn.MemAdd("key", []byte("10"), 0)
+	assert.NoError(err)
+	assert.True(stored)
+
+	stored, err = conn.MemAdd("key", []byte("20"), 0)
+	assert.NoError(err)
+	assert.False(stored)
+
+	assert.NoError(conn.MemSet("expired", []byte("1"), expired))
+	stored, err = conn.MemAdd("expired", []byte("2"), 0)
+	assert.NoError(err)
+	assert.True(stored)
+
+	// replace
+	stored, err = conn.MemReplace("missing", []byte("1"), 0)
+	assert.NoError(err)
+	assert.False(stored)
+
+	assert.NoError(conn.MemSet("expired", []byte("1"), expired))
+	stored, err = conn.MemReplace("expired", []byte("1"), 0)
+	assert.NoError(err)
+	assert.False(stored)
+
+	// append, prepend
+	stored, err = conn.MemAppend("key", []byte("0"))
+	assert.NoError(err)
+	assert.True(stored)
+
+	stored, err = conn.MemPrepend("key", []byte("1"))
+	assert.NoError(err)
+	assert.True(stored)
+
+	item, err := conn.MemGetItem("key")
+	assert.NoError(err)
+	assert.Equal([]byte("1100"), item.Value)
+
+	stored, err = conn.MemAppend("missing", []byte("0"))
+	assert.NoError(err)
+	assert.False(stored)
+
+	// incr, decr
+	value, found, err := conn.MemIncr("key", 11)
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(uint64(1111), value)
+
+	value, found, err = conn.MemDecr("key", 2000)
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(uint64(0), value)
+
+	assert.NoError(conn.MemSet("key", []byte("18446744073709551615"), 0))
+	value, found, err = conn.MemIncr("key", 2)
+	assert.NoError(err)
+	assert.Equal(uint64(1), value)
+
+	_, found, err = conn.MemIncr("missing", 1)
+	assert.NoError(err)
+	assert.False(found)
+
+	assert.NoError(conn.MemSet("key", []byte("hello"), 0))
+	_, _, err = conn.MemIncr("key", 1)
+	assert.IsType(&QueryError{}, err)
+
+	// stored tuple layout is kept
+	newItem, err := conn.MemGetItem("key")
+	assert.NoError(err)
+	assert.NotEqual(item.CAS, newItem.CAS)
+	testMemcache(t, conn)
+}
@@ -0,0 +1,467 @@
+package tnt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemcacheClient speaks memcached text protocol to the memcached port of the box (see Box.ListenMemcache).
+// It implements IMemcache, so it is interchangeable with the Mem* methods of Connection.
+// Requests are sent one by one over a single connection, which is redialed after network errors.
+type MemcacheClient struct {
+	sync.Mutex
+	addr           string
+	conn           net.Conn
+	rw             *bufio.ReadWriter
+	connectTimeout time.Duration
+	queryTimeout   time.Duration
+	dialer         func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// MemcacheClient implements IMemcache
+var _ IMemcache = &MemcacheClient{}
+
+var (
+	errMemcacheKey   = errors.New("Malformed memcache key")
+	errMemcacheReply = errors.New("Unexpected memcache reply")
+)
+
+// DialMemcache connects to the memcached port. ConnectTimeout, QueryTimeout and Dialer of opts are used.
+// Address may be "unix:/path/to.sock" as well.
+func DialMemcache(addr string, opts *Options) (*MemcacheClient, error) {
+	c := &MemcacheClient{
+		addr:           addr,
+		connectTimeout: time.Second,
+		queryTimeout:   time.Second,
+	}
+
+	if opts != nil && opts.ConnectTimeout > 0 {
+		c.connectTimeout = opts.ConnectTimeout
+	}
+
+	if opts != nil && opts.QueryTimeout > 0 {
+		c.queryTimeout = opts.QueryTimeout
+	}
+
+	if opts != nil {
+		c.dialer = opts.Dialer
+	}
+
+	if err := c.dial(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *MemcacheClient) dial() error {
+	conn, err := dialTimeout(c.dialer, c.addr, c.connectTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	return nil
+}
+
+// Close closes the connection to the memcached port.
+func (c *MemcacheClient) Close() {
+	c.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.Unlock()
+}
+
+// do runs single request-reply exchange. The connection is dropped on any error except QueryError,
+// since the stream position is unknown after it.
+func (c *MemcacheClient) do(exchange func(rw *bufio.ReadWriter) error) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return newCausedError(ErrConnectionClosed, err)
+		}
+	}
+
+	c.conn.SetDeadline(time.Now().Add(c.queryTimeout))
+
+	err := exchange(c.rw)
+	if err == nil {
+		err = c.rw.Flush()
+	}
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*QueryError); ok {
+		return err
+	}
+
+	c.conn.Close()
+	c.conn = nil
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return ErrResponseTimeout
+	}
+	return newCausedError(ErrConnectionClosed, err)
+}
+
+func checkMemcacheKey(key string) error {
+	if len(key) == 0 || len(key) > 250 {
+		return &QueryError{error: errMemcacheKey}
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return &QueryError{error: errMemcacheKey}
+		}
+	}
+	return nil
+}
+
+// readMemcacheLine returns reply line without trailing "\r\n".
+// Error replies are returned as QueryError.
+func readMemcacheLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	switch {
+	case line == "ERROR":
+		return "", NewQueryError("Unknown memcache command")
+	case strings.HasPrefix(line, "CLIENT_ERROR "), strings.HasPrefix(line, "SERVER_ERROR "):
+		return "", NewQueryError(line)
+	}
+	return line, nil
+}
+
+// readMemcacheValues reads "VALUE <key> <flags> <bytes> [<cas>]" blocks up to "END".
+func readMemcacheValues(r *bufio.Reader, cb func(key string, item *MemItem)) error {
+	for {
+		line, err := readMemcacheLine(r)
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return nil
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || len(fields) > 5 || fields[0] != "VALUE" {
+			return fmt.Errorf("%s: %q", errMemcacheReply, line)
+		}
+
+		item := &MemItem{}
+		flags, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return err
+		}
+		item.Flags = uint32(flags)
+
+		size, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return err
+		}
+
+		if len(fields) == 5 {
+			if item.CAS, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+				return err
+			}
+		}
+
+		item.Value = make([]byte, size+2)
+		if _, err = io.ReadFull(r, item.Value); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(item.Value, []byte("\r\n")) {
+			return fmt.Errorf("%s: value of %s is not terminated", errMemcacheReply, fields[1])
+		}
+		item.Value = item.Value[:size]
+
+		cb(fields[1], item)
+	}
+}
+
+func (c *MemcacheClient) MemGet(key string) ([]byte, error) {
+	item, err := c.MemGetItem(key)
+	if item == nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+// MemGetItem returns nil if key is missing or expired.
+// Memcached protocol doesn't return expiration, so Expires of the item is always 0.
+func (c *MemcacheClient) MemGetItem(key string) (*MemItem, error) {
+	if err := checkMemcacheKey(key); err != nil {
+		return nil, err
+	}
+
+	var result *MemItem
+	err := c.do(func(rw *bufio.ReadWriter) error {
+		if _, err := fmt.Fprintf(rw, "gets %s\r\n", key); err != nil {
+			return err
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		return readMemcacheValues(rw.Reader, func(_ string, item *MemItem) {
+			result = item
+		})
+	})
+
+	return result, err
+}
+
+// MemGetMulti returns values of found keys. Missing and expired keys are absent in the result.
+func (c *MemcacheClient) MemGetMulti(keys []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(keys))
+
+	for start := 0; start < len(keys); start += memcacheMultiChunk {
+		end := start + memcacheMultiChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		for _, key := range keys[start:end] {
+			if err := checkMemcacheKey(key); err != nil {
+				return nil, err
+			}
+		}
+
+		err := c.do(func(rw *bufio.ReadWriter) error {
+			if _, err := fmt.Fprintf(rw, "get %s\r\n", strings.Join(keys[start:end], " ")); err != nil {
+				return err
+			}
+			if err := rw.Flush(); err != nil {
+				return err
+			}
+			return readMemcacheValues(rw.Reader, func(key string, item *MemItem) {
+				result[key] = item.Value
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// store sends storage command and returns true if reply is STORED.
+// Suffix is appended to the command line after <bytes>, it is used for CAS unique.
+func (c *MemcacheClient) store(cmd string, key string, value []byte, flags uint32, expires uint32, suffix string) (bool, error) {
+	if err := checkMemcacheKey(key); err != nil {
+		return false, err
+	}
+
+	var stored bool
+	err := c.do(func(rw *bufio.ReadWriter) error {
+		if _, err := fmt.Fprintf(rw, "%s %s %d %d %d%s\r\n", cmd, key, flags, expires, len(value), suffix); err != nil {
+			return err
+		}
+		if _, err := rw.Write(value); err != nil {
+			return err
+		}
+		if _, err := rw.WriteString("\r\n"); err != nil {
+			return err
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+
+		line, err := readMemcacheLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+
+		switch line {
+		case "STORED":
+			stored = true
+		case "NOT_STORED", "EXISTS", "NOT_FOUND":
+			stored = false
+		default:
+			return fmt.Errorf("%s: %q", errMemcacheReply, line)
+		}
+		return nil
+	})
+
+	return stored, err
+}
+
+func (c *MemcacheClient) MemSet(key string, value []byte, expires uint32) error {
+	_, err := c.store("set", key, value, 0, expires, "")
+	return err
+}
+
+// MemSetItem stores item with its flags and expiration, item.CAS is ignored.
+func (c *MemcacheClient) MemSetItem(key string, item *MemItem) error {
+	_, err := c.store("set", key, item.Value, item.Flags, item.Expires, "")
+	return err
+}
+
+// MemCAS stores value with expiration like MemSet, but only if CAS of the key is equal to cas.
+func (c *MemcacheClient) MemCAS(key string, value []byte, expires uint32, cas uint64) (bool, error) {
+	return c.store("cas", key, value, 0, expires, " "+strconv.FormatUint(cas, 10))
+}
+
+// MemAdd stores value only if the key is missing or expired.
+func (c *MemcacheClient) MemAdd(key string, value []byte, expires uint32) (bool, error) {
+	return c.store("add", key, value, 0, expires, "")
+}
+
+// MemReplace stores value only if the key exists.
+func (c *MemcacheClient) MemReplace(key string, value []byte, expires uint32) (bool, error) {
+	return c.store("replace", key, value, 0, expires, "")
+}
+
+// MemAppend adds value after the existing one. It returns false if the key is missing.
+func (c *MemcacheClient) MemAppend(key string, value []byte) (bool, error) {
+	return c.store("append", key, value, 0, 0, "")
+}
+
+// MemPrepend adds value before the existing one. It returns false if the key is missing.
+func (c *MemcacheClient) MemPrepend(key string, value []byte) (bool, error) {
+	return c.store("prepend", key, value, 0, 0, "")
+}
+
+// command sends single line command and returns reply line.
+func (c *MemcacheClient) command(key string, format string, args ...interface{}) (string, error) {
+	if err := checkMemcacheKey(key); err != nil {
+		return "", err
+	}
+
+	var line string
+	err := c.do(func(rw *bufio.ReadWriter) error {
+		if _, err := fmt.Fprintf(rw, format, args...); err != nil {
+			return err
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		var err error
+		line, err = readMemcacheLine(rw.Reader)
+		return err
+	})
+
+	return line, err
+}
+
+func (c *MemcacheClient) incr(cmd string, key string, delta uint64) (uint64, bool, error) {
+	line, err := c.command(key, "%s %s %d\r\n", cmd, key, delta)
+	if err != nil || line == "NOT_FOUND" {
+		return 0, false, err
+	}
+
+	// memcached pads decremented value with spaces
+	value, err := strconv.ParseUint(strings.TrimRight(line, " "), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %q", errMemcacheReply, line)
+	}
+	return value, true, nil
+}
+
+// MemIncr increments decimal value of the key by delta and returns the new value.
+// It returns false if the key is missing.
+func (c *MemcacheClient) MemIncr(key string, delta uint64) (uint64, bool, error) {
+	return c.incr("incr", key, delta)
+}
+
+// MemDecr decrements decimal value of the key by delta and returns the new value.
+// It returns false if the key is missing.
+func (c *MemcacheClient) MemDecr(key string, delta uint64) (uint64, bool, error) {
+	return c.incr("decr", key, delta)
+}
+
+// MemTouch changes expiration of the key. It returns false if the key is missing.
+func (c *MemcacheClient) MemTouch(key string, expires uint32) (bool, error) {
+	line, err := c.command(key, "touch %s %d\r\n", key, expires)
+	if err != nil {
+		return false, err
+	}
+
+	switch line {
+	case "TOUCHED":
+		return true, nil
+	case "NOT_FOUND":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s: %q", errMemcacheReply, line)
+}
+
+func (c *MemcacheClient) MemDelete(key string) error {
+	line, err := c.command(key, "delete %s\r\n", key)
+	if err != nil {
+		return err
+	}
+
+	switch line {
+	case "DELETED", "NOT_FOUND":
+		return nil
+	}
+	return fmt.Errorf("%s: %q", errMemcacheReply, line)
+}
+
+// MemDeleteMulti sends deletes of all the keys without waiting for each reply.
+// It returns the first error occurred.
+func (c *MemcacheClient) MemDeleteMulti(keys []string) error {
+	for _, key := range keys {
+		if err := checkMemcacheKey(key); err != nil {
+			return err
+		}
+	}
+
+	for start := 0; start < len(keys); start += memcacheMultiChunk {
+		end := start + memcacheMultiChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		err := c.do(func(rw *bufio.ReadWriter) error {
+			for _, key := range keys[start:end] {
+				if _, err := fmt.Fprintf(rw, "delete %s\r\n", key); err != nil {
+					return err
+				}
+			}
+			if err := rw.Flush(); err != nil {
+				return err
+			}
+
+			// read all the replies to keep the stream in sync
+			var firstErr error
+			for range keys[start:end] {
+				line, err := readMemcacheLine(rw.Reader)
+				if _, ok := err.(*QueryError); ok {
+					if firstErr == nil {
+						firstErr = err
+					}
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if line != "DELETED" && line != "NOT_FOUND" && firstErr == nil {
+					firstErr = fmt.Errorf("%s: %q", errMemcacheReply, line)
+				}
+			}
+			return firstErr
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
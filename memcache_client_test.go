@@ -0,0 +1,290 @@
+package tnt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMemcached serves subset of memcached text protocol from memory
+func fakeMemcached(listener net.Listener) {
+	var mu sync.Mutex
+	var cas uint64
+	data := make(map[string]*MemItem)
+
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			r := bufio.NewReader(c)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				f := strings.Fields(line)
+				if len(f) == 0 {
+					continue
+				}
+
+				mu.Lock()
+				var reply string
+				switch f[0] {
+				case "get", "gets":
+					for _, key := range f[1:] {
+						if item, ok := data[key]; ok {
+							reply += fmt.Sprintf("VALUE %s %d %d %d\r\n%s\r\n", key, item.Flags, len(item.Value), item.CAS, item.Value)
+						}
+					}
+					reply += "END\r\n"
+				case "set", "add", "replace", "append", "prepend", "cas":
+					flags, _ := strconv.Atoi(f[2])
+					size, _ := strconv.Atoi(f[4])
+					value := make([]byte, size+2)
+					io.ReadFull(r, value)
+					value = value[:size]
+
+					item, exists := data[f[1]]
+					switch {
+					case f[0] == "add" && exists, f[0] != "set" && f[0] != "add" && !exists:
+						reply = "NOT_STORED\r\n"
+					case f[0] == "cas" && strconv.FormatUint(item.CAS, 10) != f[5]:
+						reply = "EXISTS\r\n"
+					default:
+						cas++
+						switch f[0] {
+						case "append":
+							value = append(append([]byte{}, item.Value...), value...)
+						case "prepend":
+							value = append(value, item.Value...)
+						}
+						data[f[1]] = &MemItem{Value: value, Flags: uint32(flags), CAS: cas}
+						reply = "STORED\r\n"
+					}
+				case "incr", "decr":
+					item, exists := data[f[1]]
+					if !exists {
+						reply = "NOT_FOUND\r\n"
+						break
+					}
+					value, err := strconv.ParseUint(string(item.Value), 10, 64)
+					if err != nil {
+						reply = "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+						break
+					}
+					delta, _ := strconv.ParseUint(f[2], 10, 64)
+					if f[0] == "incr" {
+						value += delta
+					} else if delta > value {
+						value = 0
+					} else {
+						value -= delta
+					}
+					item.Value = []byte(strconv.FormatUint(value, 10))
+					reply = string(item.Value) + "\r\n"
+				case "touch":
+					reply = "NOT_FOUND\r\n"
+					if _, exists := data[f[1]]; exists {
+						reply = "TOUCHED\r\n"
+					}
+				case "delete":
+					reply = "NOT_FOUND\r\n"
+					if _, exists := data[f[1]]; exists {
+						delete(data, f[1])
+						reply = "DELETED\r\n"
+					}
+				default:
+					reply = "ERROR\r\n"
+				}
+				mu.Unlock()
+
+				if _, err = io.WriteString(c, reply); err != nil {
+					return
+				}
+			}
+		}(c)
+	}
+}
+
+// testMemcache checks IMemcache implementation with fresh keys
+func testMemcache(t *testing.T, mc IMemcache) {
+	assert := assert.New(t)
+
+	prefix := fmt.Sprintf("mc_%d_", time.Now().UnixNano())
+	key := prefix + "key"
+	expires := uint32(time.Now().Add(time.Hour).Unix())
+
+	data, err := mc.MemGet(key)
+	assert.NoError(err)
+	assert.Nil(data)
+
+	assert.NoError(mc.MemSetItem(key, &MemItem{Value: []byte("10"), Flags: 3, Expires: expires}))
+	item, err := mc.MemGetItem(key)
+	assert.NoError(err)
+	if !assert.NotNil(item) {
+		return
+	}
+	assert.Equal([]byte("10"), item.Value)
+	assert.Equal(uint32(3), item.Flags)
+
+	stored, err := mc.MemCAS(key, []byte("20"), expires, item.CAS+1)
+	assert.NoError(err)
+	assert.False(stored)
+
+	stored, err = mc.MemCAS(key, []byte("20"), expires, item.CAS)
+	assert.NoError(err)
+	assert.True(stored)
+
+	stored, err = mc.MemAdd(key, []byte("30"), 0)
+	assert.NoError(err)
+	assert.False(stored)
+
+	stored, err = mc.MemReplace(prefix+"missing", []byte("30"), 0)
+	assert.NoError(err)
+	assert.False(stored)
+
+	stored, err = mc.MemAppend(key, []byte("1"))
+	assert.NoError(err)
+	assert.True(stored)
+
+	stored, err = mc.MemPrepend(key, []byte("1"))
+	assert.NoError(err)
+	assert.True(stored)
+
+	value, found, err := mc.MemIncr(key, 10)
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(uint64(1211), value)
+
+	value, found, err = mc.MemDecr(key, 2000)
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(uint64(0), value)
+
+	_, found, err = mc.MemIncr(prefix+"missing", 1)
+	assert.NoError(err)
+	assert.False(found)
+
+	assert.NoError(mc.MemSet(prefix+"other", []byte("hello"), expires))
+	multi, err := mc.MemGetMulti([]string{key, prefix + "other", prefix + "missing"})
+	assert.NoError(err)
+	assert.Equal(map[string][]byte{key: []byte("0"), prefix + "other": []byte("hello")}, multi)
+
+	assert.NoError(mc.MemDeleteMulti([]string{key, prefix + "other", prefix + "missing"}))
+	multi, err = mc.MemGetMulti([]string{key, prefix + "other"})
+	assert.NoError(err)
+	assert.Empty(multi)
+}
+
+func TestMemcacheClient(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	go fakeMemcached(listener)
+
+	mc, err := DialMemcache(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer mc.Close()
+
+	testMemcache(t, mc)
+
+	touched, err := mc.MemTouch("missing", 0)
+	assert.NoError(err)
+	assert.False(touched)
+
+	_, err = mc.MemGet("bad key")
+	assert.IsType(&QueryError{}, err)
+
+	// reconnect after network error
+	mc.conn.Close()
+	_, err = mc.MemGet("key")
+	assert.IsType(&ConnectionError{}, err)
+	_, err = mc.MemGet("key")
+	assert.NoError(err)
+}
+
+func TestMemcacheCrossCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	primaryPort, tearDown := setUp(t)
+	if t.Skipped() {
+		return
+	}
+	defer tearDown()
+
+	conn, err := Connect(fmt.Sprintf("127.0.0.1:%d", primaryPort), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	mc, err := DialMemcache(fmt.Sprintf("127.0.0.1:%d", testTntMemcachePort), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer mc.Close()
+
+	testMemcache(t, conn)
+	testMemcache(t, mc)
+
+	// values written through one transport are seen through another
+	key := fmt.Sprintf("cross_%d", time.Now().UnixNano())
+	assert.NoError(conn.MemSetItem(key, &MemItem{Value: []byte("iproto"), Flags: 5}))
+
+	item, err := mc.MemGetItem(key)
+	assert.NoError(err)
+	if assert.NotNil(item) {
+		assert.Equal([]byte("iproto"), item.Value)
+		assert.Equal(uint32(5), item.Flags)
+	}
+
+	assert.NoError(mc.MemSet(key, []byte("text"), 0))
+	data, err := conn.MemGet(key)
+	assert.NoError(err)
+	assert.Equal([]byte("text"), data)
+
+	// CAS stores expiration on both transports
+	expires := uint32(time.Now().Unix() + 3600)
+	assert.NoError(conn.MemSetItem(key, &MemItem{Value: []byte("v1"), Expires: expires}))
+	item, err = conn.MemGetItem(key)
+	assert.NoError(err)
+	if assert.NotNil(item) {
+		stored, err := conn.MemCAS(key, []byte("v2"), expires, item.CAS)
+		assert.NoError(err)
+		assert.True(stored)
+	}
+	item, err = conn.MemGetItem(key)
+	assert.NoError(err)
+	if assert.NotNil(item) {
+		assert.Equal(expires, item.Expires)
+		stored, err := mc.MemCAS(key, []byte("v3"), expires, item.CAS)
+		assert.NoError(err)
+		assert.True(stored)
+	}
+	item, err = conn.MemGetItem(key)
+	assert.NoError(err)
+	if assert.NotNil(item) {
+		assert.Equal([]byte("v3"), item.Value)
+		assert.Equal(expires, item.Expires)
+	}
+
+	assert.NoError(conn.MemDelete(key))
+}
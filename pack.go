@@ -291,11 +291,11 @@ func (q *Insert) Pack(requestID uint32, defaultSpace uint32) ([]byte, error) {
 	} else {
 		binary.LittleEndian.PutUint32(data[12:], defaultSpace)
 	}
+	flags := uint32(q.Mode)
 	if q.ReturnTuple {
-		copy(data[16:], packedInt1)
-	} else {
-		copy(data[16:], packedInt0)
+		flags |= flagReturnTuple
 	}
+	binary.LittleEndian.PutUint32(data[16:], flags)
 	copy(data[20:], tuple)
 
 	return data, nil
@@ -395,4 +395,13 @@ func (q *Call) Pack(requestID uint32, defaultSpace uint32) ([]byte, error) {
 	copy(data[16 + name:], tuple)
 
 	return data, nil
-}
\ No newline at end of file
+}
+
+func (q *Ping) Pack(requestID uint32, defaultSpace uint32) ([]byte, error) {
+	data := make([]byte, 12)
+
+	binary.LittleEndian.PutUint32(data, requestTypePing)
+	binary.LittleEndian.PutUint32(data[8:], requestID)
+
+	return data, nil
+}
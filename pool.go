@@ -0,0 +1,117 @@
+package tnt
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool spreads queries over several connections to the same box round robin.
+// Connections are established on demand and reestablished after close.
+type Pool struct {
+	executor
+	connectors []*Connector
+	next       uint32
+	closeOnce  sync.Once
+	closed     chan bool
+}
+
+// NewPool returns pool of size connections to addr, size less than 1 means Options.PoolSize or 1.
+// Addr may be DSN (see ParseDSN). Malformed DSN is not reported by NewPool, every query fails with its error.
+func NewPool(addr string, size int, opts *Options) *Pool {
+	if resolved, resolvedOpts, err := resolveAddr(addr, opts); err == nil {
+		addr, opts = resolved, resolvedOpts
+	}
+
+	if size < 1 && opts != nil {
+		size = opts.PoolSize
+	}
+	if size < 1 {
+		size = 1
+	}
+	p := &Pool{
+		connectors: make([]*Connector, size),
+		closed:     make(chan bool),
+	}
+	for i := range p.connectors {
+		p.connectors[i] = New(addr, opts)
+	}
+	p.executor.init(opts, p.execute)
+	return p
+}
+
+// Pool implements IConnection
+var _ IConnection = &Pool{}
+
+// conn returns the next connection.
+func (p *Pool) conn() (*Connection, error) {
+	if p.IsClosed() {
+		return nil, ErrConnectionClosed
+	}
+	c := p.connectors[atomic.AddUint32(&p.next, 1)%uint32(len(p.connectors))]
+	conn, err := c.Connect()
+	if err != nil {
+		return nil, err
+	}
+	// Close might miss the connection made concurrently
+	if p.IsClosed() {
+		c.Close()
+		return nil, ErrConnectionClosed
+	}
+	return conn, nil
+}
+
+// execute does the query on the next connection bypassing interceptors of connections.
+func (p *Pool) execute(ctx context.Context, q Query) ([]Tuple, error) {
+	conn, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.execute(ctx, q)
+}
+
+// Close closes all the connections, queries fail with ErrConnectionClosed after it.
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	for _, c := range p.connectors {
+		c.Close()
+	}
+}
+
+// Shutdown gracefully closes all the connections, see Connection.Shutdown.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for _, c := range p.connectors {
+		wg.Add(1)
+		go func(c *Connector) {
+			defer wg.Done()
+			if err := c.Shutdown(ctx); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// IsClosed returns true after Close or Shutdown call.
+func (p *Pool) IsClosed() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
+}
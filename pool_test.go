@@ -0,0 +1,97 @@
+package tnt
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+
+	var accepted int32
+	counting := &countingListener{Listener: listener, accepted: &accepted}
+	go fakeServer(counting, func(requestType uint32, body []byte) []byte {
+		return tuplesReply(Tuple{Bytes("ok")})
+	})
+
+	pool := NewPool(listener.Addr().String(), 3, nil)
+	for i := 0; i < 10; i++ {
+		data, err := pool.Execute(&Select{Value: PackInt(1)})
+		assert.NoError(err)
+		assert.Equal([]Tuple{{Bytes("ok")}}, data)
+	}
+	assert.Equal(int32(3), atomic.LoadInt32(&accepted))
+
+	// broken connection is reestablished
+	conn, err := pool.connectors[0].Connect()
+	assert.NoError(err)
+	conn.Close()
+	for i := 0; i < 3; i++ {
+		_, err = pool.Execute(&Ping{})
+		assert.NoError(err)
+	}
+	assert.Equal(int32(4), atomic.LoadInt32(&accepted))
+
+	assert.False(pool.IsClosed())
+	pool.Close()
+	assert.True(pool.IsClosed())
+	_, err = pool.Execute(&Ping{})
+	assert.Equal(ErrConnectionClosed, err)
+}
+
+// connections of the pool are established concurrently with shared options, run it with -race
+func TestPoolConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer listener.Close()
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		return tuplesReply(Tuple{Bytes("ok")})
+	})
+
+	opts := &Options{}
+	pool := NewPool(listener.Addr().String(), 4, opts)
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := pool.ExecuteOptions(&Select{Value: PackInt(1)}, &QueryOptions{Timeout: time.Second})
+			assert.NoError(err)
+			assert.Equal([]Tuple{{Bytes("ok")}}, data)
+		}()
+	}
+	wg.Wait()
+
+	// defaults are not written to options of the caller
+	assert.Equal(Options{}, *opts)
+}
+
+type countingListener struct {
+	net.Listener
+	accepted *int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(l.accepted, 1)
+	}
+	return c, err
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"encoding/binary"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// Error codes of replies made by proxy itself.
+const (
+	// ErrCodeIllegalParams is the box code for malformed requests, the proxy uses it for routing errors too.
+	ErrCodeIllegalParams = 0x02
+	// ErrCodeUpstream means the upstream has failed (e.g. timeout or connection close), the request may be retried.
+	// It is not used by the box.
+	ErrCodeUpstream = 0xff
+)
+
+// Completion status is the low byte of return code.
+const (
+	statusTransient = 1
+	statusError     = 2
+)
+
+func packHeader(requestType uint32, requestID uint32, bodyLen int) []byte {
+	data := make([]byte, 12, 12+bodyLen)
+	binary.LittleEndian.PutUint32(data, requestType)
+	binary.LittleEndian.PutUint32(data[4:], uint32(bodyLen))
+	binary.LittleEndian.PutUint32(data[8:], requestID)
+	return data
+}
+
+// packError packs error reply. QueryError of the box is sent as is.
+func packError(requestType uint32, requestID uint32, err error) []byte {
+	code := uint32(ErrCodeUpstream<<8 | statusTransient)
+	if queryErr, ok := err.(*tnt.QueryError); ok && queryErr.Code != 0 {
+		code = queryErr.Code<<8 | statusError
+	}
+	return packErrorCode(requestType, requestID, code, err.Error())
+}
+
+func packErrorCode(requestType uint32, requestID uint32, code uint32, message string) []byte {
+	data := packHeader(requestType, requestID, 4+len(message)+1)
+	data = append(data, tnt.PackInt(code)...)
+	data = append(data, message...)
+	return append(data, 0)
+}
+
+// packTuples packs successful reply with count of affected tuples. Tuples are omitted unless withTuples.
+func packTuples(requestType uint32, requestID uint32, tuples []tnt.Tuple, withTuples bool) []byte {
+	bodyLen := 8
+	if withTuples {
+		for _, tuple := range tuples {
+			bodyLen += 8
+			for _, field := range tuple {
+				bodyLen += len(tnt.PackIntBase128(uint32(len(field)))) + len(field)
+			}
+		}
+	}
+
+	data := packHeader(requestType, requestID, bodyLen)
+	data = append(data, 0, 0, 0, 0)
+	data = append(data, tnt.PackInt(uint32(len(tuples)))...)
+	if !withTuples {
+		return data
+	}
+
+	for _, tuple := range tuples {
+		sizeOffset := len(data)
+		data = append(data, 0, 0, 0, 0)
+		data = append(data, tnt.PackInt(uint32(len(tuple)))...)
+		for _, field := range tuple {
+			data = append(data, tnt.PackIntBase128(uint32(len(field)))...)
+			data = append(data, field...)
+		}
+		// size doesn't include cardinality
+		binary.LittleEndian.PutUint32(data[sizeOffset:], uint32(len(data)-sizeOffset-8))
+	}
+	return data
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// Upstream executes queries, e.g. *tnt.Pool or *tnt.Connection.
+type Upstream interface {
+	Exec(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error)
+}
+
+// Router chooses upstream for query. Error is sent to the client with ErrCodeIllegalParams.
+type Router interface {
+	Route(q tnt.Query) (Upstream, error)
+}
+
+// RouterFunc is the function implementing Router.
+type RouterFunc func(q tnt.Query) (Upstream, error)
+
+func (f RouterFunc) Route(q tnt.Query) (Upstream, error) {
+	return f(q)
+}
+
+// ErrNoRoute is returned by routers for queries they have no upstream for.
+var ErrNoRoute = errors.New("No upstream for the request")
+
+// querySpace returns space of query, false for Call and Ping.
+func querySpace(q tnt.Query) (uint32, bool) {
+	var space interface{}
+	switch q := q.(type) {
+	case *tnt.Select:
+		space = q.Space
+	case *tnt.Insert:
+		space = q.Space
+	case *tnt.Update:
+		space = q.Space
+	case *tnt.Delete:
+		space = q.Space
+	}
+	id, ok := space.(uint32)
+	return id, ok
+}
+
+// SpaceRouter routes queries by space. Call goes to Default as well as spaces missing in Spaces.
+type SpaceRouter struct {
+	Spaces  map[uint32]Upstream
+	Default Upstream
+}
+
+func (r *SpaceRouter) Route(q tnt.Query) (Upstream, error) {
+	if space, ok := querySpace(q); ok {
+		if upstream, ok := r.Spaces[space]; ok {
+			return upstream, nil
+		}
+	}
+	if r.Default == nil {
+		return nil, ErrNoRoute
+	}
+	return r.Default, nil
+}
+
+// KeyRouter routes queries by hash of the first key field over Shards.
+// The key is the first field of Insert tuple, Update and Delete key, the first argument of Call.
+// Select is routed if all its keys belong to the same shard.
+type KeyRouter struct {
+	Shards []Upstream
+	// Hash is crc32 (IEEE) by default.
+	Hash func(field []byte) uint32
+}
+
+func (r *KeyRouter) shard(key tnt.Tuple) (int, error) {
+	if len(key) == 0 {
+		return 0, errors.New("Request has no key to route by")
+	}
+	hash := r.Hash
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+	return int(hash(key[0]) % uint32(len(r.Shards))), nil
+}
+
+func (r *KeyRouter) Route(q tnt.Query) (Upstream, error) {
+	if len(r.Shards) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	var key tnt.Tuple
+	switch q := q.(type) {
+	case *tnt.Select:
+		keys := q.Tuples
+		switch {
+		case q.Value != nil:
+			keys = []tnt.Tuple{{q.Value}}
+		case q.Values != nil:
+			keys = make([]tnt.Tuple, len(q.Values))
+			for i, value := range q.Values {
+				keys[i] = tnt.Tuple{value}
+			}
+		}
+		if len(keys) == 0 {
+			return nil, errors.New("Request has no key to route by")
+		}
+
+		shard, err := r.shard(keys[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys[1:] {
+			other, err := r.shard(key)
+			if err != nil {
+				return nil, err
+			}
+			if other != shard {
+				return nil, errors.New("Keys of select belong to different shards")
+			}
+		}
+		return r.Shards[shard], nil
+	case *tnt.Insert:
+		key = q.Tuple
+	case *tnt.Update:
+		key = q.Tuple
+	case *tnt.Delete:
+		key = q.Tuple
+	case *tnt.Call:
+		key = q.Tuple
+	}
+
+	shard, err := r.shard(key)
+	if err != nil {
+		return nil, err
+	}
+	return r.Shards[shard], nil
+}
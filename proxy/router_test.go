@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/stretchr/testify/assert"
+)
+
+type namedUpstream string
+
+func (u namedUpstream) Exec(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+	return nil, nil
+}
+
+func TestSpaceRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &SpaceRouter{Spaces: map[uint32]Upstream{1: namedUpstream("one")}}
+
+	upstream, err := r.Route(&tnt.Select{Space: uint32(1)})
+	assert.NoError(err)
+	assert.Equal(namedUpstream("one"), upstream)
+
+	_, err = r.Route(&tnt.Select{Space: uint32(2)})
+	assert.Equal(ErrNoRoute, err)
+
+	r.Default = namedUpstream("default")
+	upstream, err = r.Route(&tnt.Insert{Space: uint32(2)})
+	assert.NoError(err)
+	assert.Equal(namedUpstream("default"), upstream)
+
+	upstream, err = r.Route(&tnt.Call{Name: tnt.Bytes("proc")})
+	assert.NoError(err)
+	assert.Equal(namedUpstream("default"), upstream)
+}
+
+func TestKeyRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &KeyRouter{
+		Shards: []Upstream{namedUpstream("even"), namedUpstream("odd")},
+		Hash:   func(field []byte) uint32 { return uint32(field[0]) },
+	}
+
+	cases := []struct {
+		q        tnt.Query
+		upstream Upstream
+	}{
+		{&tnt.Select{Value: tnt.Bytes{1}}, namedUpstream("odd")},
+		{&tnt.Select{Values: []tnt.Bytes{{2}, {4}}}, namedUpstream("even")},
+		{&tnt.Select{Tuples: []tnt.Tuple{{{3}, {0}}}}, namedUpstream("odd")},
+		{&tnt.Insert{Tuple: tnt.Tuple{{2}, {1}}}, namedUpstream("even")},
+		{&tnt.Update{Tuple: tnt.Tuple{{5}}}, namedUpstream("odd")},
+		{&tnt.Delete{Tuple: tnt.Tuple{{6}}}, namedUpstream("even")},
+		{&tnt.Call{Name: tnt.Bytes("proc"), Tuple: tnt.Tuple{{7}}}, namedUpstream("odd")},
+	}
+	for _, c := range cases {
+		upstream, err := r.Route(c.q)
+		assert.NoError(err, "%#v", c.q)
+		assert.Equal(c.upstream, upstream, "%#v", c.q)
+	}
+
+	for _, q := range []tnt.Query{
+		&tnt.Select{Values: []tnt.Bytes{{1}, {2}}},
+		&tnt.Select{Tuples: []tnt.Tuple{{}}},
+		&tnt.Select{},
+		&tnt.Call{Name: tnt.Bytes("proc")},
+	} {
+		_, err := r.Route(q)
+		assert.Error(err, "%#v", q)
+	}
+
+	// default hash
+	r.Hash = nil
+	_, err := r.Route(&tnt.Delete{Tuple: tnt.Tuple{tnt.Bytes("key")}})
+	assert.NoError(err)
+}
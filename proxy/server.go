@@ -0,0 +1,293 @@
+// Package proxy implements tarantool 1.5 iproto server which forwards requests of many clients
+// over a few upstream connections.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	tnt "github.com/lomik/go-tnt"
+)
+
+// ErrServerClosed is returned by Serve after Close call.
+var ErrServerClosed = errors.New("Proxy server closed")
+
+const (
+	defaultMaxInFlight    = 256
+	defaultMaxRequestSize = 1 << 20
+)
+
+// Server accepts iproto clients and forwards their requests to upstreams chosen by Router.
+// Ping is replied by the proxy itself. Replies are sent back as soon as they are ready,
+// so they may be reordered the same way the box does.
+type Server struct {
+	Router Router
+	// Timeout limits upstream query, 0 means the upstream's own query timeout.
+	Timeout time.Duration
+	// MaxInFlight limits requests of a client being forwarded at once, further requests are not read.
+	// 256 by default.
+	MaxInFlight int
+	// MaxRequestSize limits request body in bytes, 1MB by default.
+	// The client sending larger request is replied with ErrCodeIllegalParams and disconnected.
+	MaxRequestSize int
+	// Logger receives client connection errors. Nothing is logged by default.
+	Logger tnt.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+	closed    bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func (s *Server) init() {
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+		s.conns = make(map[net.Conn]bool)
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	}
+}
+
+// ListenAndServe listens on TCP address and serves clients until Close.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients on l until Close. It always returns non-nil error, ErrServerClosed after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.init()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(c)
+
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops listeners, disconnects clients and waits for their requests to finish.
+// Upstreams are not closed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.init()
+	s.closed = true
+	s.cancel()
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn reads requests until the client disconnects and waits for their replies to be written.
+func (s *Server) serveConn(c net.Conn) {
+	defer c.Close()
+
+	maxInFlight := s.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+
+	replies := make(chan []byte, maxInFlight)
+	inFlight := make(chan struct{}, maxInFlight)
+	writerDone := make(chan bool)
+
+	go func() {
+		defer close(writerDone)
+		if err := writeReplies(c, replies); err != nil {
+			s.logf("proxy: write to %s: %s", c.RemoteAddr(), err)
+			// unblock reader
+			c.Close()
+			for range replies {
+			}
+		}
+	}()
+
+	maxRequestSize := s.MaxRequestSize
+	if maxRequestSize <= 0 {
+		maxRequestSize = defaultMaxRequestSize
+	}
+
+	var wg sync.WaitGroup
+	err := s.readRequests(c, maxRequestSize, func(requestType uint32, requestID uint32, body []byte) {
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replies <- s.handle(requestType, requestID, body)
+			<-inFlight
+		}()
+	})
+	if err != nil && err != io.EOF {
+		s.logf("proxy: read from %s: %s", c.RemoteAddr(), err)
+	}
+
+	wg.Wait()
+	var sizeErr *requestSizeError
+	if errors.As(err, &sizeErr) {
+		replies <- packErrorCode(sizeErr.requestType, sizeErr.requestID, ErrCodeIllegalParams<<8|statusError, sizeErr.Error())
+	}
+	close(replies)
+	<-writerDone
+}
+
+// requestSizeError means the request body is larger than Server.MaxRequestSize, the body is not read.
+type requestSizeError struct {
+	requestType uint32
+	requestID   uint32
+	size        uint32
+	maxSize     int
+}
+
+func (e *requestSizeError) Error() string {
+	return fmt.Sprintf("Request is too large: %d bytes, max %d", e.size, e.maxSize)
+}
+
+func (s *Server) readRequests(c net.Conn, maxSize int, handle func(requestType uint32, requestID uint32, body []byte)) error {
+	r := bufio.NewReader(c)
+	header := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		size := tnt.UnpackInt(header[4:8])
+		if uint64(size) > uint64(maxSize) {
+			return &requestSizeError{
+				requestType: tnt.UnpackInt(header[0:4]),
+				requestID:   tnt.UnpackInt(header[8:12]),
+				size:        size,
+				maxSize:     maxSize,
+			}
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+		handle(tnt.UnpackInt(header[0:4]), tnt.UnpackInt(header[8:12]), body)
+	}
+}
+
+// writeReplies flushes the buffer when there are no more replies ready.
+func writeReplies(c net.Conn, replies chan []byte) error {
+	w := bufio.NewWriter(c)
+	for reply := range replies {
+		if _, err := w.Write(reply); err != nil {
+			return err
+		}
+		if len(replies) == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// handle returns packed reply to the request.
+func (s *Server) handle(requestType uint32, requestID uint32, body []byte) []byte {
+	q, err := tnt.UnpackQuery(requestType, body)
+	if err != nil {
+		return packErrorCode(requestType, requestID, ErrCodeIllegalParams<<8|statusError, err.Error())
+	}
+
+	if _, ok := q.(*tnt.Ping); ok {
+		return packHeader(requestType, requestID, 0)
+	}
+
+	upstream, err := s.Router.Route(q)
+	if err != nil {
+		return packErrorCode(requestType, requestID, ErrCodeIllegalParams<<8|statusError, err.Error())
+	}
+
+	// affected tuples are counted by returned ones, so they are requested always
+	withTuples := true
+	switch q := q.(type) {
+	case *tnt.Insert:
+		withTuples, q.ReturnTuple = q.ReturnTuple, true
+	case *tnt.Update:
+		withTuples, q.ReturnTuple = q.ReturnTuple, true
+	case *tnt.Delete:
+		withTuples, q.ReturnTuple = q.ReturnTuple, true
+	}
+
+	ctx := s.ctx
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	tuples, err := upstream.Exec(ctx, q)
+	if err != nil {
+		return packError(requestType, requestID, err)
+	}
+	return packTuples(requestType, requestID, tuples, withTuples)
+}
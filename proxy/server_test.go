@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	tnt "github.com/lomik/go-tnt"
+	"github.com/stretchr/testify/assert"
+)
+
+// upstreamFunc is the function implementing Upstream.
+type upstreamFunc func(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error)
+
+func (f upstreamFunc) Exec(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+	return f(ctx, q)
+}
+
+func startServer(t *testing.T, s *Server) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(listener)
+	return listener.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var queries []tnt.Query
+	upstream := upstreamFunc(func(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+		mu.Lock()
+		queries = append(queries, q)
+		mu.Unlock()
+
+		switch q := q.(type) {
+		case *tnt.Select:
+			return []tnt.Tuple{{tnt.Bytes("a"), tnt.PackInt(1)}, {tnt.Bytes("b")}}, nil
+		case *tnt.Insert:
+			return []tnt.Tuple{q.Tuple}, nil
+		case *tnt.Delete:
+			return nil, tnt.NewQueryErrorCode(tnt.ErrCodeTupleNotFound, "Tuple doesn't exist")
+		}
+		return nil, tnt.ErrResponseTimeout
+	})
+
+	s := &Server{Router: &SpaceRouter{Default: upstream}}
+	addr := startServer(t, s)
+	defer s.Close()
+
+	conn, err := tnt.Connect(addr+"/3", nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.NoError(err)
+
+	data, err := conn.Execute(&tnt.Select{Values: []tnt.Bytes{tnt.PackInt(1), tnt.PackInt(2)}, Index: 1})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{{tnt.Bytes("a"), tnt.PackInt(1)}, {tnt.Bytes("b")}}, data)
+
+	data, err = conn.Execute(&tnt.Insert{Tuple: tnt.Tuple{tnt.Bytes("key")}})
+	assert.NoError(err)
+	assert.Empty(data)
+
+	data, err = conn.Execute(&tnt.Insert{Tuple: tnt.Tuple{tnt.Bytes("key")}, ReturnTuple: true, Mode: tnt.InsertAdd})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{{tnt.Bytes("key")}}, data)
+
+	_, err = conn.Execute(&tnt.Delete{Tuple: tnt.Tuple{tnt.Bytes("key")}})
+	if assert.IsType(&tnt.QueryError{}, err) {
+		assert.Equal(uint32(tnt.ErrCodeTupleNotFound), err.(*tnt.QueryError).Code)
+		assert.Equal("Tuple doesn't exist", err.Error())
+	}
+
+	_, err = conn.Execute(&tnt.Call{Name: tnt.Bytes("proc")})
+	if assert.IsType(&tnt.QueryError{}, err) {
+		assert.Equal(uint32(ErrCodeUpstream), err.(*tnt.QueryError).Code)
+		assert.Contains(err.Error(), tnt.ErrResponseTimeout.Error())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(queries, 5) {
+		assert.Equal(&tnt.Select{
+			Space:  uint32(3),
+			Index:  1,
+			Limit:  0xffffffff,
+			Tuples: []tnt.Tuple{{tnt.PackInt(1)}, {tnt.PackInt(2)}},
+		}, queries[0])
+		// tuples are requested to count affected ones
+		assert.True(queries[1].(*tnt.Insert).ReturnTuple)
+		assert.Equal(tnt.InsertAdd, queries[2].(*tnt.Insert).Mode)
+	}
+}
+
+func TestServerBadRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Server{Router: &SpaceRouter{}}
+	addr := startServer(t, s)
+	defer s.Close()
+
+	c, err := net.Dial("tcp", addr)
+	if !assert.NoError(err) {
+		return
+	}
+	defer c.Close()
+
+	// unknown request type, then select without route
+	request := append(append(tnt.PackInt(1), tnt.PackInt(0)...), tnt.PackInt(7)...)
+	_, err = c.Write(request)
+	assert.NoError(err)
+
+	reply := make([]byte, 16)
+	_, err = io.ReadFull(c, reply)
+	assert.NoError(err)
+	assert.Equal(uint32(1), tnt.UnpackInt(reply[0:4]))
+	assert.Equal(uint32(7), tnt.UnpackInt(reply[8:12]))
+	assert.Equal(uint32(ErrCodeIllegalParams<<8|statusError), tnt.UnpackInt(reply[12:16]))
+	message := make([]byte, tnt.UnpackInt(reply[4:8])-4)
+	_, err = io.ReadFull(c, message)
+	assert.NoError(err)
+
+	conn, err := tnt.Connect(addr, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Execute(&tnt.Select{Value: tnt.PackInt(1)})
+	if assert.IsType(&tnt.QueryError{}, err) {
+		assert.Equal(uint32(ErrCodeIllegalParams), err.(*tnt.QueryError).Code)
+		assert.Equal(ErrNoRoute.Error(), err.Error())
+	}
+}
+
+func TestServerMaxRequestSize(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Server{Router: &SpaceRouter{}, MaxRequestSize: 16}
+	addr := startServer(t, s)
+	defer s.Close()
+
+	c, err := net.Dial("tcp", addr)
+	if !assert.NoError(err) {
+		return
+	}
+	defer c.Close()
+
+	// header claims 4GB body
+	request := append(append(tnt.PackInt(17), tnt.PackInt(0xffffffff)...), tnt.PackInt(9)...)
+	_, err = c.Write(request)
+	assert.NoError(err)
+
+	reply := make([]byte, 16)
+	_, err = io.ReadFull(c, reply)
+	assert.NoError(err)
+	assert.Equal(uint32(17), tnt.UnpackInt(reply[0:4]))
+	assert.Equal(uint32(9), tnt.UnpackInt(reply[8:12]))
+	assert.Equal(uint32(ErrCodeIllegalParams<<8|statusError), tnt.UnpackInt(reply[12:16]))
+	message := make([]byte, tnt.UnpackInt(reply[4:8])-4)
+	_, err = io.ReadFull(c, message)
+	assert.NoError(err)
+	assert.Contains(string(message), "Request is too large")
+
+	// client is disconnected
+	_, err = c.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+}
+
+func TestServerClose(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Server{Router: &SpaceRouter{}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+
+	served := make(chan error)
+	go func() {
+		served <- s.Serve(listener)
+	}()
+
+	conn, err := tnt.Connect(listener.Addr().String(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.NoError(err)
+
+	assert.NoError(s.Close())
+	assert.Equal(ErrServerClosed, <-served)
+
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.Error(err)
+}
@@ -0,0 +1,233 @@
+package tnt
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgePolicy makes ReplicaSet send Select to the next replica if the first one is slow, see Options.Hedge.
+type HedgePolicy struct {
+	// Delay is the time to wait for the first replica, 0 means Percentile of recent Select latencies.
+	// QueryOptions.HedgeDelay and WithHedgeDelay override it per query.
+	Delay time.Duration
+	// Percentile of latencies used as delay, 0.95 by default.
+	// Selects are not hedged until hedgeMinSamples latencies are known.
+	Percentile float64
+	// MinDelay is the lower bound of the delay derived from latencies, 1ms by default.
+	MinDelay time.Duration
+}
+
+// hedgeMinSamples is the number of latencies needed for delay by percentile.
+const hedgeMinSamples = 20
+
+// latencyWindow keeps recent latencies and their percentile, which is updated every latencyUpdate records.
+type latencyWindow struct {
+	mu         sync.Mutex
+	samples    [256]time.Duration
+	count      int
+	percentile time.Duration
+}
+
+const latencyUpdate = 32
+
+func (w *latencyWindow) record(d time.Duration, percentile float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples[w.count%len(w.samples)] = d
+	w.count++
+	if w.count%latencyUpdate != 0 && w.count != hedgeMinSamples {
+		return
+	}
+
+	n := w.count
+	if n > len(w.samples) {
+		n = len(w.samples)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	w.percentile = sorted[int(percentile*float64(n-1))]
+}
+
+// get returns the percentile or false if there are too few latencies.
+func (w *latencyWindow) get() (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.percentile, w.count >= hedgeMinSamples
+}
+
+type hedgeDelayKey struct{}
+
+// WithHedgeDelay sets hedge delay of Select done with the returned context, negative delay disables hedging.
+func WithHedgeDelay(ctx context.Context, delay time.Duration) context.Context {
+	return context.WithValue(ctx, hedgeDelayKey{}, delay)
+}
+
+// ReplicaSet is the client of master and its replicas. Writes and calls go to the master,
+// Select is spread round robin over all the boxes and hedged by Options.Hedge.
+// Each box is connected by Pool of Options.PoolSize connections.
+// Interceptors and Retry run once per query, not per box or hedged request.
+// Every box has its own copy of Options.CircuitBreaker, so a failing replica doesn't fail writes to the master.
+type ReplicaSet struct {
+	executor
+	pools     []*Pool
+	next      uint32
+	hedge     *HedgePolicy
+	latencies latencyWindow
+}
+
+// ReplicaSet implements IConnection
+var _ IConnection = &ReplicaSet{}
+
+// NewReplicaSet returns client of boxes at addrs, the first one is the master.
+// Addrs may be DSNs, malformed ones fail queries to their boxes like in NewPool.
+func NewReplicaSet(addrs []string, opts *Options) *ReplicaSet {
+	var setOpts, boxOpts Options
+	if opts != nil {
+		setOpts, boxOpts = *opts, *opts
+	}
+	setOpts.CircuitBreaker = nil
+	boxOpts.Interceptors, boxOpts.Retry = nil, nil
+
+	rs := &ReplicaSet{
+		pools: make([]*Pool, len(addrs)),
+		hedge: setOpts.Hedge,
+	}
+	for i, addr := range addrs {
+		o := boxOpts
+		if o.CircuitBreaker != nil {
+			o.CircuitBreaker = o.CircuitBreaker.clone(addr)
+		}
+		rs.pools[i] = NewPool(addr, 0, &o)
+	}
+	rs.executor.init(&setOpts, rs.execute)
+	return rs
+}
+
+func (rs *ReplicaSet) execute(ctx context.Context, q Query) ([]Tuple, error) {
+	if len(rs.pools) == 0 {
+		return nil, ErrConnectionClosed
+	}
+	if _, ok := q.(*Select); !ok {
+		return rs.pools[0].invoke(ctx, q)
+	}
+
+	first := int(atomic.AddUint32(&rs.next, 1) % uint32(len(rs.pools)))
+	delay, hedged := rs.hedgeDelay(ctx)
+	if !hedged || len(rs.pools) < 2 {
+		return rs.read(ctx, first, q)
+	}
+	return rs.hedgedRead(ctx, first, delay, q)
+}
+
+// hedgeDelay returns the delay of hedged request or false if query isn't hedged.
+func (rs *ReplicaSet) hedgeDelay(ctx context.Context) (time.Duration, bool) {
+	if delay, ok := ctx.Value(hedgeDelayKey{}).(time.Duration); ok && delay != 0 {
+		return delay, delay > 0
+	}
+	if rs.hedge == nil {
+		return 0, false
+	}
+	if rs.hedge.Delay > 0 {
+		return rs.hedge.Delay, true
+	}
+
+	delay, ok := rs.latencies.get()
+	minDelay := rs.hedge.MinDelay
+	if minDelay <= 0 {
+		minDelay = time.Millisecond
+	}
+	if delay < minDelay {
+		delay = minDelay
+	}
+	return delay, ok
+}
+
+// read does the query on i-th box through its circuit breaker and records its latency.
+func (rs *ReplicaSet) read(ctx context.Context, i int, q Query) ([]Tuple, error) {
+	start := time.Now()
+	result, err := rs.pools[i].invoke(ctx, q)
+	if err == nil && rs.hedge != nil {
+		percentile := rs.hedge.Percentile
+		if percentile <= 0 || percentile > 1 {
+			percentile = 0.95
+		}
+		rs.latencies.record(time.Since(start), percentile)
+	}
+	return result, err
+}
+
+// hedgedRead sends the query to the next box if the first one hasn't replied after delay or has failed.
+// The first successful reply wins, the other request is canceled and removed from the request map.
+func (rs *ReplicaSet) hedgedRead(ctx context.Context, first int, delay time.Duration, q Query) ([]Tuple, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type reply struct {
+		result []Tuple
+		err    error
+	}
+	replies := make(chan reply, 2)
+	send := func(i int) {
+		go func() {
+			result, err := rs.read(ctx, i, q)
+			replies <- reply{result, err}
+		}()
+	}
+
+	send(first)
+	pending := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedge := timer.C
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-replies:
+			pending--
+			if r.err == nil {
+				return r.result, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if hedge == nil {
+				continue
+			}
+		case <-hedge:
+		}
+
+		hedge = nil
+		send((first + 1) % len(rs.pools))
+		pending++
+	}
+	return nil, firstErr
+}
+
+// Close closes connections to all the boxes, queries fail with ErrConnectionClosed after it.
+func (rs *ReplicaSet) Close() {
+	for _, p := range rs.pools {
+		p.Close()
+	}
+}
+
+// Shutdown gracefully closes connections to all the boxes, see Connection.Shutdown.
+func (rs *ReplicaSet) Shutdown(ctx context.Context) error {
+	var firstErr error
+	for _, p := range rs.pools {
+		if err := p.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// IsClosed returns true after Close or Shutdown call.
+func (rs *ReplicaSet) IsClosed() bool {
+	return len(rs.pools) == 0 || rs.pools[0].IsClosed()
+}
@@ -0,0 +1,230 @@
+package tnt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// count returns the number of requests in flight
+func (m *requestMap) count() int {
+	n := 0
+	for i := range m.slots {
+		lock := m.lock(uint32(i))
+		lock.Lock()
+		if m.slots[i].req != nil {
+			n++
+		}
+		lock.Unlock()
+	}
+	return n
+}
+
+func TestExecCancel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		return nil
+	})
+
+	conn, err := Connect(listener.Addr().String(), &Options{QueryTimeout: time.Minute})
+	require.NoError(err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = conn.Exec(ctx, &Ping{})
+	assert.Equal(context.Canceled, err)
+	assert.True(time.Since(start) < time.Second)
+	assert.Equal(0, conn.requests.count())
+	assert.False(conn.IsClosed())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = conn.Exec(ctx, &Ping{})
+	assert.Equal(ErrResponseTimeout, err)
+}
+
+// replicaServer replies to select by its name after delay, other requests are counted
+func replicaServer(t *testing.T, name string, delay time.Duration, writes *int32) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		if requestType != requestTypeSelect {
+			atomic.AddInt32(writes, 1)
+			return emptyReply
+		}
+		time.Sleep(delay)
+		return tuplesReply(Tuple{Bytes(name)})
+	})
+	return listener
+}
+
+func TestReplicaSetHedge(t *testing.T) {
+	assert := assert.New(t)
+
+	var masterWrites, replicaWrites int32
+	master := replicaServer(t, "master", 300*time.Millisecond, &masterWrites)
+	defer master.Close()
+	replica := replicaServer(t, "replica", 0, &replicaWrites)
+	defer replica.Close()
+
+	rs := NewReplicaSet([]string{master.Addr().String(), replica.Addr().String()}, &Options{
+		QueryTimeout: time.Second,
+		PoolSize:     4,
+		Hedge:        &HedgePolicy{Delay: 20 * time.Millisecond},
+	})
+	defer rs.Close()
+
+	// every select is replied by the fast replica, including ones sent to the master first
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		tuples, err := rs.Execute(&Select{Value: PackInt(1)})
+		assert.NoError(err)
+		assert.Equal([]Tuple{{Bytes("replica")}}, tuples)
+		assert.True(time.Since(start) < 200*time.Millisecond)
+	}
+
+	// losing requests are removed from the request map of the master
+	inFlight := func() int {
+		n := 0
+		for _, c := range rs.pools[0].connectors {
+			c.Lock()
+			conn := c.conn
+			c.Unlock()
+			if conn != nil {
+				n += conn.requests.count()
+			}
+		}
+		return n
+	}
+	for deadline := time.Now().Add(time.Second); inFlight() != 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(0, inFlight())
+
+	// negative delay disables hedging, so the master replies to every second select
+	var masterReplies int
+	for i := 0; i < 2; i++ {
+		tuples, err := rs.ExecuteOptions(&Select{Value: PackInt(1)}, &QueryOptions{HedgeDelay: -1})
+		assert.NoError(err)
+		if assert.Len(tuples, 1) && string(tuples[0][0]) == "master" {
+			masterReplies++
+		}
+	}
+	assert.Equal(1, masterReplies)
+
+	// writes go to the master only
+	_, err := rs.Execute(&Insert{Tuple: Tuple{PackInt(1)}})
+	assert.NoError(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&masterWrites))
+	assert.Equal(int32(0), atomic.LoadInt32(&replicaWrites))
+}
+
+func TestReplicaSetFailover(t *testing.T) {
+	assert := assert.New(t)
+
+	var writes int32
+	replica := replicaServer(t, "replica", 0, &writes)
+	defer replica.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	down := listener.Addr().String()
+	listener.Close()
+
+	// failed replica is hedged at once, hedging by percentile hasn't started yet
+	rs := NewReplicaSet([]string{down, replica.Addr().String()}, &Options{Hedge: &HedgePolicy{}})
+	defer rs.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := rs.ExecuteOptions(&Select{Value: PackInt(1)}, &QueryOptions{HedgeDelay: time.Minute})
+		assert.NoError(err)
+	}
+
+	_, err = rs.Execute(&Insert{Tuple: Tuple{PackInt(1)}})
+	var netErr net.Error
+	assert.True(errors.As(err, &netErr))
+}
+
+func TestLatencyWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	var w latencyWindow
+	for i := 1; i < hedgeMinSamples; i++ {
+		w.record(time.Duration(i)*time.Millisecond, 0.9)
+	}
+	_, ok := w.get()
+	assert.False(ok)
+
+	w.record(hedgeMinSamples*time.Millisecond, 0.9)
+	d, ok := w.get()
+	assert.True(ok)
+	assert.Equal(18*time.Millisecond, d)
+
+	// old latencies are forgotten
+	for i := 0; i < 1000; i++ {
+		w.record(time.Second, 0.9)
+	}
+	d, _ = w.get()
+	assert.Equal(time.Second, d)
+}
+
+func TestReplicaSetCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var writes int32
+	master := replicaServer(t, "master", 0, &writes)
+	defer master.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	down := listener.Addr().String()
+	listener.Close()
+
+	var mu sync.Mutex
+	opened := make(map[string]int)
+	breaker := &CircuitBreaker{
+		MinQueries:  2,
+		OpenTimeout: time.Minute,
+		OnStateChange: func(name string, from CircuitState, to CircuitState) {
+			if to == CircuitOpen {
+				mu.Lock()
+				opened[name]++
+				mu.Unlock()
+			}
+		},
+	}
+	rs := NewReplicaSet([]string{master.Addr().String(), down}, &Options{CircuitBreaker: breaker})
+	defer rs.Close()
+
+	// selects to the failed replica open its circuit only
+	var open int
+	for i := 0; i < 8; i++ {
+		_, err := rs.Execute(&Select{Value: PackInt(1)})
+		if err == ErrCircuitOpen {
+			open++
+		}
+	}
+	assert.True(open > 0)
+	assert.Equal(CircuitClosed, breaker.State())
+	mu.Lock()
+	assert.Equal(map[string]int{down: 1}, opened)
+	mu.Unlock()
+
+	_, err = rs.Execute(&Insert{Tuple: Tuple{PackInt(1)}})
+	assert.NoError(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&writes))
+}
@@ -1,64 +1,90 @@
 package tnt
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
 
-const requestMapShardNum = 16
+const (
+	requestMapLockNum     = 64
+	defaultRequestMapSize = 1 << 14
+)
 
-type requestMapShard struct {
-	sync.Mutex
-	data map[uint32]*request
+type requestMapSlot struct {
+	id  uint32
+	req *request
 }
+
+// requestMap is a ring of power-of-two number of slots indexed by request ID.
+// Every slot keeps full ID of its request, so a late reply with ID from
+// the previous round over the ring never matches the current request.
 type requestMap struct {
-	shard []*requestMapShard
+	nextID uint32
+	mask   uint32
+	slots  []requestMapSlot
+	locks  [requestMapLockNum]sync.Mutex
 }
 
-func newRequestMap() *requestMap {
-	shard := make([]*requestMapShard, requestMapShardNum)
-
-	for i := 0; i < requestMapShardNum; i++ {
-		shard[i] = &requestMapShard{
-			data: make(map[uint32]*request),
-		}
+// newRequestMap returns ring with at least size slots.
+func newRequestMap(size int) *requestMap {
+	n := requestMapLockNum
+	for n < size {
+		n <<= 1
 	}
 
 	return &requestMap{
-		shard: shard,
+		mask:  uint32(n - 1),
+		slots: make([]requestMapSlot, n),
 	}
+}
 
+func (m *requestMap) lock(slot uint32) *sync.Mutex {
+	return &m.locks[slot%requestMapLockNum]
 }
 
-// Put returns old request associated with given key
-func (m *requestMap) Put(key uint32, value *request) *request {
-	shard := m.shard[key%requestMapShardNum]
-	shard.Lock()
-	oldValue := shard.data[key]
-	shard.data[key] = value
-	shard.Unlock()
-	return oldValue
+// Put allocates request ID for value skipping IDs of requests still in flight.
+// It returns false if all the slots are busy.
+func (m *requestMap) Put(value *request) (uint32, bool) {
+	for i := 0; i < len(m.slots); i++ {
+		key := atomic.AddUint32(&m.nextID, 1)
+		slot := key & m.mask
+		lock := m.lock(slot)
+		lock.Lock()
+		if m.slots[slot].req == nil {
+			m.slots[slot] = requestMapSlot{id: key, req: value}
+			lock.Unlock()
+			return key, true
+		}
+		lock.Unlock()
+	}
+	return 0, false
 }
 
 // Pop returns request associated with given key and remove it from map
 func (m *requestMap) Pop(key uint32) *request {
-	shard := m.shard[key%requestMapShardNum]
-	shard.Lock()
-	value, exists := shard.data[key]
-	if exists {
-		delete(shard.data, key)
+	slot := key & m.mask
+	lock := m.lock(slot)
+	lock.Lock()
+	value := m.slots[slot].req
+	if value == nil || m.slots[slot].id != key {
+		lock.Unlock()
+		return nil
 	}
-	shard.Unlock()
+	m.slots[slot].req = nil
+	lock.Unlock()
 	return value
 }
 
 func (m *requestMap) CleanUp(clearCallback func(*request)) {
-	for i := 0; i < requestMapShardNum; i++ {
-		shard := m.shard[i]
-		shard.Lock()
+	for i := range m.slots {
+		lock := m.lock(uint32(i))
+		lock.Lock()
+		value := m.slots[i].req
+		m.slots[i].req = nil
+		lock.Unlock()
 
-		for requestID, req := range shard.data {
-			delete(shard.data, requestID)
-			clearCallback(req)
+		if value != nil {
+			clearCallback(value)
 		}
-
-		shard.Unlock()
 	}
 }
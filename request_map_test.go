@@ -0,0 +1,144 @@
+package tnt
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestMapSkipsBusyIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newRequestMap(0)
+	size := uint32(len(m.slots))
+	assert.Equal(requestMapLockNum, int(size))
+
+	busy := &request{}
+	busyID, ok := m.Put(busy)
+	assert.True(ok)
+
+	// go round the ring up to the busy slot
+	for i := uint32(1); i < size; i++ {
+		id, ok := m.Put(&request{})
+		assert.True(ok)
+		assert.Equal(busyID+i, id)
+		m.Pop(id)
+	}
+
+	id, ok := m.Put(&request{})
+	assert.True(ok)
+	assert.Equal(busyID+size+1, id)
+
+	// late reply from the previous round doesn't match
+	assert.Nil(m.Pop(id - size))
+	assert.NotNil(m.Pop(id))
+	assert.Equal(busy, m.Pop(busyID))
+	assert.Nil(m.Pop(busyID))
+}
+
+func TestRequestMapFull(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newRequestMap(0)
+	for i := 0; i < len(m.slots); i++ {
+		_, ok := m.Put(&request{})
+		assert.True(ok)
+	}
+	_, ok := m.Put(&request{})
+	assert.False(ok)
+
+	cnt := 0
+	m.CleanUp(func(*request) {
+		cnt++
+	})
+	assert.Equal(len(m.slots), cnt)
+
+	_, ok = m.Put(&request{})
+	assert.True(ok)
+}
+
+// shardedRequestMap is the previous implementation of requestMap kept for benchmarks
+type shardedRequestMap struct {
+	shard []*shardedRequestMapShard
+}
+
+type shardedRequestMapShard struct {
+	sync.Mutex
+	data map[uint32]*request
+}
+
+func newShardedRequestMap() *shardedRequestMap {
+	shard := make([]*shardedRequestMapShard, 16)
+	for i := range shard {
+		shard[i] = &shardedRequestMapShard{
+			data: make(map[uint32]*request),
+		}
+	}
+	return &shardedRequestMap{shard: shard}
+}
+
+func (m *shardedRequestMap) Put(key uint32, value *request) *request {
+	shard := m.shard[key%16]
+	shard.Lock()
+	oldValue := shard.data[key]
+	shard.data[key] = value
+	shard.Unlock()
+	return oldValue
+}
+
+func (m *shardedRequestMap) Pop(key uint32) *request {
+	shard := m.shard[key%16]
+	shard.Lock()
+	value, exists := shard.data[key]
+	if exists {
+		delete(shard.data, key)
+	}
+	shard.Unlock()
+	return value
+}
+
+func BenchmarkRequestMap(b *testing.B) {
+	m := newRequestMap(defaultRequestMapSize)
+	req := &request{}
+	for n := 0; n < b.N; n++ {
+		id, _ := m.Put(req)
+		m.Pop(id)
+	}
+}
+
+func BenchmarkShardedRequestMap(b *testing.B) {
+	m := newShardedRequestMap()
+	req := &request{}
+	var nextID uint32
+	for n := 0; n < b.N; n++ {
+		id := atomic.AddUint32(&nextID, 1)
+		m.Put(id, req)
+		m.Pop(id)
+	}
+}
+
+func BenchmarkRequestMapParallel(b *testing.B) {
+	m := newRequestMap(defaultRequestMapSize)
+	b.RunParallel(func(pb *testing.PB) {
+		req := &request{}
+		for pb.Next() {
+			id, _ := m.Put(req)
+			m.Pop(id)
+		}
+	})
+}
+
+func BenchmarkShardedRequestMapParallel(b *testing.B) {
+	m := newShardedRequestMap()
+	var nextID uint32
+	b.RunParallel(func(pb *testing.PB) {
+		req := &request{}
+		for pb.Next() {
+			id := atomic.AddUint32(&nextID, 1)
+			m.Put(id, req)
+			m.Pop(id)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package tnt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// RetryPolicy retries failed queries, see Options.Retry.
+// Connection retries timeouts only, as it is never reopened. Connector and Pool reconnect.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts including the first one, less than 2 means no retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, 10ms by default. It doubles for every next retry
+	// up to MaxBackoff, 1s by default. Actual delay is random between half and full of it.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable decides whether the failed query is retried, DefaultRetryable by default.
+	Retryable func(ctx context.Context, q Query, err error) bool
+	// OnRetry is called before every retry with the number of attempts made and the last error, e.g. for metrics.
+	OnRetry func(ctx context.Context, q Query, attempts int, err error)
+	// OnDone is called once per query with the number of attempts made and the returned error,
+	// so successful retries are seen as well.
+	OnDone func(ctx context.Context, q Query, attempts int, err error)
+}
+
+// RetryError is the error of query which failed after several attempts.
+type RetryError struct {
+	Attempts int
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s (after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks queries done with the returned context as safe to retry, see QueryOptions.Idempotent.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// IsIdempotent returns true for Select and Ping, and for queries marked by WithIdempotent.
+func IsIdempotent(ctx context.Context, q Query) bool {
+	switch q.(type) {
+	case *Select, *Ping:
+		return true
+	}
+	marked, _ := ctx.Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// IsTransient returns true for errors of connection and timeouts, the box might not get or do the query.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrConnectionClosed) || errors.Is(err, ErrRequestTimeout) ||
+		errors.Is(err, ErrResponseTimeout) || errors.Is(err, ErrTooManyRequests) {
+		return true
+	}
+	// failed dial
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// DefaultRetryable retries idempotent queries failed with transient errors.
+func DefaultRetryable(ctx context.Context, q Query, err error) bool {
+	return IsIdempotent(ctx, q) && IsTransient(err)
+}
+
+// backoff returns delay before retry after attempts made.
+func (p *RetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.Backoff
+	if delay <= 0 {
+		delay = 10 * time.Millisecond
+	}
+	maxDelay := p.MaxBackoff
+	if maxDelay <= 0 {
+		maxDelay = time.Second
+	}
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// RetryInterceptor returns interceptor which retries queries by policy. Retries stop if the next one
+// wouldn't start before the context deadline. Options.Retry puts it after Options.Interceptors.
+func RetryInterceptor(policy RetryPolicy) Interceptor {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+
+	return func(ctx context.Context, q Query, next Invoker) (result []Tuple, err error) {
+		attempts := 1
+		if policy.OnDone != nil {
+			defer func() { policy.OnDone(ctx, q, attempts, err) }()
+		}
+
+		for {
+			result, err = next(ctx, q)
+			if err == nil || attempts >= policy.MaxAttempts || !retryable(ctx, q, err) {
+				if err != nil && attempts > 1 {
+					err = &RetryError{Attempts: attempts, Err: err}
+				}
+				return result, err
+			}
+
+			delay := policy.backoff(attempts)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+				return nil, &RetryError{Attempts: attempts, Err: err}
+			}
+
+			if policy.OnRetry != nil {
+				policy.OnRetry(ctx, q, attempts, err)
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+				// pass
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, &RetryError{Attempts: attempts, Err: err}
+			}
+			attempts++
+		}
+	}
+}
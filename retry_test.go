@@ -0,0 +1,151 @@
+package tnt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingInvoker fails first n calls with err
+func failingInvoker(n int, err error, calls *int) Invoker {
+	return func(ctx context.Context, q Query) ([]Tuple, error) {
+		*calls++
+		if *calls <= n {
+			return nil, err
+		}
+		return []Tuple{{Bytes("ok")}}, nil
+	}
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	assert := assert.New(t)
+
+	var retries []int
+	var done int
+	var doneErr error
+	retry := RetryInterceptor(RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		OnRetry: func(ctx context.Context, q Query, attempts int, err error) {
+			retries = append(retries, attempts)
+		},
+		OnDone: func(ctx context.Context, q Query, attempts int, err error) {
+			done, doneErr = attempts, err
+		},
+	})
+
+	// attempts of successful query are reported by OnDone
+	calls := 0
+	result, err := retry(context.Background(), &Select{}, failingInvoker(2, ErrResponseTimeout, &calls))
+	assert.NoError(err)
+	assert.Equal([]Tuple{{Bytes("ok")}}, result)
+	assert.Equal(3, calls)
+	assert.Equal([]int{1, 2}, retries)
+	assert.Equal(3, done)
+	assert.NoError(doneErr)
+
+	calls = 0
+	_, err = retry(context.Background(), &Select{}, failingInvoker(0, nil, &calls))
+	assert.NoError(err)
+	assert.Equal(1, done)
+
+	calls = 0
+	_, err = retry(context.Background(), &Select{}, failingInvoker(5, ErrConnectionClosed, &calls))
+	var retryErr *RetryError
+	if assert.True(errors.As(err, &retryErr)) {
+		assert.Equal(3, retryErr.Attempts)
+	}
+	assert.True(errors.Is(err, ErrConnectionClosed))
+	assert.Equal(3, calls)
+	assert.Equal(3, done)
+	assert.Equal(err, doneErr)
+
+	// writes are retried only if marked idempotent
+	calls = 0
+	_, err = retry(context.Background(), &Insert{}, failingInvoker(1, ErrResponseTimeout, &calls))
+	assert.Equal(ErrResponseTimeout, err)
+	assert.Equal(1, calls)
+
+	calls = 0
+	_, err = retry(WithIdempotent(context.Background()), &Insert{}, failingInvoker(1, ErrResponseTimeout, &calls))
+	assert.NoError(err)
+	assert.Equal(2, calls)
+
+	// errors of the box are not transient
+	calls = 0
+	queryErr := NewQueryErrorCode(ErrCodeNoSuchSpace, "Space 1 does not exist")
+	_, err = retry(context.Background(), &Select{}, failingInvoker(1, queryErr, &calls))
+	assert.Equal(queryErr, err)
+	assert.Equal(1, calls)
+
+	// retry which can't start before the deadline isn't done
+	slow := RetryInterceptor(RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	calls = 0
+	start := time.Now()
+	_, err = slow(ctx, &Select{}, failingInvoker(5, ErrResponseTimeout, &calls))
+	assert.True(errors.As(err, &retryErr))
+	assert.Equal(1, retryErr.Attempts)
+	assert.True(time.Since(start) < 100*time.Millisecond)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		d := p.backoff(1)
+		assert.True(d >= 5*time.Millisecond && d <= 10*time.Millisecond, d)
+		d = p.backoff(3)
+		assert.True(d >= 20*time.Millisecond && d <= 40*time.Millisecond, d)
+		d = p.backoff(10)
+		assert.True(d >= 25*time.Millisecond && d <= 50*time.Millisecond, d)
+	}
+}
+
+func TestConnectionRetry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer listener.Close()
+
+	// every odd request is not replied
+	var requests int32
+	go fakeServer(listener, func(requestType uint32, body []byte) []byte {
+		if atomic.AddInt32(&requests, 1)%2 == 1 {
+			return nil
+		}
+		return emptyReply
+	})
+
+	conn, err := Connect(listener.Addr().String(), &Options{
+		QueryTimeout: 50 * time.Millisecond,
+		Retry:        &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond},
+	})
+	require.NoError(err)
+	defer conn.Close()
+
+	_, err = conn.Execute(&Select{Value: PackInt(1)})
+	assert.NoError(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+
+	_, err = conn.Execute(&Insert{Tuple: Tuple{PackInt(1)}})
+	assert.Equal(ErrResponseTimeout, err)
+	assert.Equal(int32(3), atomic.LoadInt32(&requests))
+
+	_, err = conn.Execute(&Ping{})
+	assert.NoError(err)
+
+	_, err = conn.ExecuteOptions(&Insert{Tuple: Tuple{PackInt(1)}}, &QueryOptions{Idempotent: true})
+	assert.NoError(err)
+	assert.Equal(int32(6), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,270 @@
+package tnt
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Raw is the field type of opaque bytes. It is valid for Schema only, not for BoxConfig.
+const Raw FieldType = "RAW"
+
+// FieldConfig describes tuple field for clients.
+type FieldConfig struct {
+	Name string    `json:"name,omitempty"`
+	Type FieldType `json:"type"`
+}
+
+// Schema describes spaces for encoding and decoding of tuple fields.
+// JSON form is {"spaces": [{"id": 1, "name": "users", "fields": [{"name": "id", "type": "NUM"}], "indexes": [...]}]}.
+type Schema struct {
+	Spaces []SpaceConfig `json:"spaces"`
+}
+
+// ReadSchema decodes JSON schema.
+func ReadSchema(r io.Reader) (*Schema, error) {
+	schema := &Schema{}
+	if err := json.NewDecoder(r).Decode(schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// LoadSchema reads JSON schema from file.
+func LoadSchema(filename string) (*Schema, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	schema, err := ReadSchema(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return schema, nil
+}
+
+// Space returns description of space with id or nil. It is safe to call on nil Schema.
+func (s *Schema) Space(id uint32) *SpaceConfig {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Spaces {
+		if s.Spaces[i].ID == id {
+			return &s.Spaces[i]
+		}
+	}
+	return nil
+}
+
+// FieldType returns type of i-th field, Raw if it is unknown. It is safe to call on nil SpaceConfig.
+func (s *SpaceConfig) FieldType(i int) FieldType {
+	if s == nil || i >= len(s.Fields) || s.Fields[i].Type == "" {
+		return Raw
+	}
+	return s.Fields[i].Type
+}
+
+// FieldName returns name of i-th field or its number. It is safe to call on nil SpaceConfig.
+func (s *SpaceConfig) FieldName(i int) string {
+	if s == nil || i >= len(s.Fields) || s.Fields[i].Name == "" {
+		return strconv.Itoa(i)
+	}
+	return s.Fields[i].Name
+}
+
+// KeyTypes returns types of key parts of index, nil if it is unknown.
+func (s *SpaceConfig) KeyTypes(index uint32) []FieldType {
+	if s == nil || int(index) >= len(s.Indexes) {
+		return nil
+	}
+	types := make([]FieldType, len(s.Indexes[index].Parts))
+	for i, part := range s.Indexes[index].Parts {
+		types[i] = part.Type
+	}
+	return types
+}
+
+// DecodeTuple returns fields of tuple decoded by the space description.
+func (s *SpaceConfig) DecodeTuple(tuple Tuple) ([]interface{}, error) {
+	values := make([]interface{}, len(tuple))
+	for i, field := range tuple {
+		value, err := s.FieldType(i).Decode(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", s.FieldName(i), err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// EncodeTuple packs values (e.g. decoded from JSON) by the space description.
+func (s *SpaceConfig) EncodeTuple(values []interface{}) (Tuple, error) {
+	tuple := make(Tuple, len(values))
+	for i, value := range values {
+		field, err := s.FieldType(i).Encode(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", s.FieldName(i), err)
+		}
+		tuple[i] = field
+	}
+	return tuple, nil
+}
+
+// Decode returns uint32 for Num, uint64 for Num64 and string for Str.
+// Raw field is returned as string if it is printable UTF-8, otherwise it is "hex:" prefixed hex dump.
+func (t FieldType) Decode(field Bytes) (interface{}, error) {
+	switch t {
+	case Num:
+		if len(field) != 4 {
+			return nil, fmt.Errorf("NUM field must have 4 bytes, got %d", len(field))
+		}
+		return UnpackInt(field), nil
+	case Num64:
+		if len(field) != 8 {
+			return nil, fmt.Errorf("NUM64 field must have 8 bytes, got %d", len(field))
+		}
+		return UnpackLong(field), nil
+	case Str:
+		return string(field), nil
+	case Raw:
+		if isPrintable(field) {
+			return string(field), nil
+		}
+		return "hex:" + hex.EncodeToString(field), nil
+	}
+	return nil, fmt.Errorf("unknown field type %q", t)
+}
+
+func isPrintable(field Bytes) bool {
+	if !utf8.Valid(field) {
+		return false
+	}
+	for _, r := range string(field) {
+		if r < ' ' || r == 0x7f {
+			return false
+		}
+	}
+	// typed strings would be parsed back by ParseField as other bytes
+	return !hasTypePrefix(string(field))
+}
+
+func hasTypePrefix(s string) bool {
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		switch s[:i] {
+		case "num", "num64", "str", "hex":
+			return true
+		}
+	}
+	return false
+}
+
+// Encode packs value of Go type (number, json.Number or string) to field.
+// String value is parsed by Parse, so "42" is a valid Num.
+func (t FieldType) Encode(value interface{}) (Bytes, error) {
+	switch v := value.(type) {
+	case string:
+		return t.Parse(v)
+	case json.Number:
+		return t.Parse(v.String())
+	case []byte:
+		return Bytes(v), nil
+	case Bytes:
+		return v, nil
+	}
+
+	var n uint64
+	switch v := value.(type) {
+	case uint32:
+		n = uint64(v)
+	case uint64:
+		n = v
+	case int:
+		if v < 0 {
+			return nil, fmt.Errorf("negative number %d", v)
+		}
+		n = uint64(v)
+	case int64:
+		if v < 0 {
+			return nil, fmt.Errorf("negative number %d", v)
+		}
+		n = uint64(v)
+	case float64:
+		if v < 0 || v != math.Trunc(v) || v > math.MaxUint64 {
+			return nil, fmt.Errorf("not an unsigned integer %v", v)
+		}
+		n = uint64(v)
+	default:
+		return nil, fmt.Errorf("unsupported value %#v", value)
+	}
+
+	switch t {
+	case Num:
+		if n > math.MaxUint32 {
+			return nil, fmt.Errorf("NUM overflow %d", n)
+		}
+		return PackInt(uint32(n)), nil
+	case Num64:
+		return PackLong(n), nil
+	}
+	return nil, fmt.Errorf("number for %s field", t)
+}
+
+// Parse packs string representation of the field. Raw field is parsed by ParseField.
+func (t FieldType) Parse(s string) (Bytes, error) {
+	switch t {
+	case Num:
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return PackInt(uint32(n)), nil
+	case Num64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return PackLong(n), nil
+	case Str:
+		return Bytes(s), nil
+	case Raw:
+		return ParseField(s)
+	}
+	return nil, fmt.Errorf("unknown field type %q", t)
+}
+
+// ParseField packs field given with type prefix: "num:42", "num64:42", "str:foo" or "hex:0a0b".
+// String without known prefix is returned as is.
+func ParseField(s string) (Bytes, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return Bytes(s), nil
+	}
+
+	switch s[:i] {
+	case "num":
+		return Num.Parse(s[i+1:])
+	case "num64":
+		return Num64.Parse(s[i+1:])
+	case "str":
+		return Bytes(s[i+1:]), nil
+	case "hex":
+		return hex.DecodeString(s[i+1:])
+	}
+	return Bytes(s), nil
+}
+
+// ParseTypedField packs s by its type prefix if any, otherwise by t.
+func ParseTypedField(s string, t FieldType) (Bytes, error) {
+	if hasTypePrefix(s) {
+		return ParseField(s)
+	}
+	return t.Parse(s)
+}
@@ -0,0 +1,105 @@
+package tnt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `{"spaces": [{
+	"id": 1,
+	"name": "users",
+	"fields": [{"name": "id", "type": "NUM"}, {"name": "login", "type": "STR"}, {"name": "balance", "type": "NUM64"}],
+	"indexes": [{"type": "HASH", "unique": true, "parts": [{"field": 0, "type": "NUM"}]}]
+}]}`
+
+func TestSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	schema, err := ReadSchema(strings.NewReader(testSchema))
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Nil(schema.Space(2))
+	space := schema.Space(1)
+	if !assert.NotNil(space) {
+		return
+	}
+	assert.Equal("users", space.Name)
+	assert.Equal(Str, space.FieldType(1))
+	assert.Equal(Raw, space.FieldType(3))
+	assert.Equal("balance", space.FieldName(2))
+	assert.Equal("3", space.FieldName(3))
+	assert.Equal([]FieldType{Num}, space.KeyTypes(0))
+	assert.Nil(space.KeyTypes(1))
+
+	tuple, err := space.EncodeTuple([]interface{}{float64(1), "bob", "100", "extra"})
+	assert.NoError(err)
+	assert.Equal(Tuple{PackInt(1), Bytes("bob"), PackLong(100), Bytes("extra")}, tuple)
+
+	values, err := space.DecodeTuple(tuple)
+	assert.NoError(err)
+	assert.Equal([]interface{}{uint32(1), "bob", uint64(100), "extra"}, values)
+
+	_, err = space.DecodeTuple(Tuple{Bytes("x")})
+	assert.Error(err)
+
+	_, err = space.EncodeTuple([]interface{}{float64(-1)})
+	assert.Error(err)
+
+	// nil schema describes nothing
+	var nilSchema *Schema
+	assert.Nil(nilSchema.Space(1))
+	assert.Equal(Raw, nilSchema.Space(1).FieldType(0))
+}
+
+func TestParseField(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		s     string
+		field Bytes
+	}{
+		{"num:42", PackInt(42)},
+		{"num64:42", PackLong(42)},
+		{"str:num:42", Bytes("num:42")},
+		{"hex:0a0b", Bytes{0x0a, 0x0b}},
+		{"plain", Bytes("plain")},
+		{"other:prefix", Bytes("other:prefix")},
+	}
+	for _, c := range cases {
+		field, err := ParseField(c.s)
+		assert.NoError(err, c.s)
+		assert.Equal(c.field, field, c.s)
+	}
+
+	for _, s := range []string{"num:x", "num:4294967296", "num64:-1", "hex:zz"} {
+		_, err := ParseField(s)
+		assert.Error(err, s)
+	}
+
+	field, err := ParseTypedField("42", Num)
+	assert.NoError(err)
+	assert.Equal(Bytes(PackInt(42)), field)
+
+	field, err = ParseTypedField("str:42", Num)
+	assert.NoError(err)
+	assert.Equal(Bytes("42"), field)
+
+	// Raw fields are decoded so that ParseField gets them back
+	for _, field := range []Bytes{Bytes("text"), {0, 1, 2}, Bytes("hex:00"), Bytes("num:42")} {
+		value, err := Raw.Decode(field)
+		assert.NoError(err)
+		parsed, err := ParseField(value.(string))
+		assert.NoError(err)
+		assert.Equal(field, parsed)
+	}
+}
+
+func TestOpSplice(t *testing.T) {
+	op := OpSplice(1, -2, 1, Bytes("ab"))
+	assert.Equal(t, OpCodeSplice, op.OpCode)
+	assert.Equal(t, Bytes{4, 0xfe, 0xff, 0xff, 0xff, 4, 1, 0, 0, 0, 2, 'a', 'b'}, op.Value)
+}
@@ -2,6 +2,7 @@ package tnt
 
 import (
 	"context"
+	"errors"
 	"net"
 	"sync"
 	"time"
@@ -16,6 +17,7 @@ const (
 	requestTypeUpdate = 19
 	requestTypeDelete = 21
 	requestTypeCall   = 22
+	requestTypePing   = 0xff00
 )
 
 type Query interface {
@@ -75,35 +77,79 @@ func (q *Select) ByteLength() (length int) {
 	return
 }
 
+const flagReturnTuple = 0x01
+
+// InsertMode defines how Insert treats a tuple with the same primary key.
+type InsertMode uint32
+
+const (
+	// InsertOrReplace stores tuple whether the same key exists or not.
+	InsertOrReplace InsertMode = 0x00
+	// InsertAdd fails with ErrCodeTupleFound if the key exists.
+	InsertAdd InsertMode = 0x02
+	// InsertReplace fails with ErrCodeTupleNotFound if the key doesn't exist.
+	InsertReplace InsertMode = 0x04
+)
+
 type Insert struct {
 	Tuple       Tuple
 	Space       interface{}
 	ReturnTuple bool
+	Mode        InsertMode
 }
 
+// OpCode is the operation of Update.
 type OpCode uint8
 
+// Operations of Update, see Op* constructors.
 const (
-	opSet OpCode = iota
-	opAdd
-	opAnd
-	opXor
-	opOr
-	opSplice
-	opDelete
-	opInsert
+	OpCodeSet OpCode = iota
+	OpCodeAdd
+	OpCodeAnd
+	OpCodeXor
+	OpCodeOr
+	OpCodeSplice
+	OpCodeDelete
+	OpCodeInsert
 )
 
 func OpSet(field uint32, value Bytes) Operator {
-	return Operator{field, opSet, value}
+	return Operator{field, OpCodeSet, value}
+}
+
+// OpAdd adds value to NUM or NUM64 field, value must be packed by PackInt or PackLong.
+func OpAdd(field uint32, value Bytes) Operator {
+	return Operator{field, OpCodeAdd, value}
+}
+
+func OpAnd(field uint32, value Bytes) Operator {
+	return Operator{field, OpCodeAnd, value}
+}
+
+func OpXor(field uint32, value Bytes) Operator {
+	return Operator{field, OpCodeXor, value}
+}
+
+func OpOr(field uint32, value Bytes) Operator {
+	return Operator{field, OpCodeOr, value}
+}
+
+// OpSplice replaces length bytes of the field from offset by value.
+// Negative offset counts from the end of the field.
+func OpSplice(field uint32, offset int32, length int32, value Bytes) Operator {
+	arg := make([]byte, base128len(4)*2+base128len(len(value)))
+	n := packFieldStr(PackInt(uint32(offset)), arg)
+	n += packFieldStr(PackInt(uint32(length)), arg[n:])
+	packFieldStr(value, arg[n:])
+	return Operator{field, OpCodeSplice, arg}
 }
 
 func OpDelete(field uint32, value Bytes) Operator {
-	return Operator{field, opDelete, value}
+	return Operator{field, OpCodeDelete, value}
 }
 
 func OpInsert(field uint32, value Bytes) Operator {
-	return Operator{field, opInsert, value}
+	return Operator{field, OpCodeInsert, value}
 }
 
 type Operator struct {
@@ -132,11 +178,15 @@ type Call struct {
 	ReturnTuple bool
 }
 
+// Ping checks the box is alive. Reply has no tuples.
+type Ping struct{}
+
 var _ Query = (*Select)(nil)
 var _ Query = (*Insert)(nil)
 var _ Query = (*Update)(nil)
 var _ Query = (*Delete)(nil)
 var _ Query = (*Call)(nil)
+var _ Query = (*Ping)(nil)
 
 type Response struct {
 	Data  []Tuple
@@ -148,16 +198,66 @@ type Options struct {
 	QueryTimeout   time.Duration
 	MemcacheSpace  interface{}
 	DefaultSpace   interface{}
+	// Logger receives the reason of connection close. Nothing is logged by default.
+	Logger Logger
+	// MaxInFlight limits the number of requests sent and not yet replied. 0 means no limit.
+	// Query waits for a free slot until its timeout expires.
+	MaxInFlight int
+	// FailOnMaxInFlight makes query return ErrTooManyRequests at once instead of waiting for a free slot.
+	FailOnMaxInFlight bool
+	// Dialer establishes connections instead of the default one, which dials TCP or Unix socket
+	// if the address is "unix:/path/to.sock". Address is passed without the default space,
+	// ctx expires after ConnectTimeout.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error)
+	// PoolSize is the number of connections of NewPool if its size argument is 0, 1 by default.
+	PoolSize int
+	// Interceptors wrap all the queries including Mem* ones, see Interceptor.
+	// Connector and Pool run them once per query, not per their connection.
+	Interceptors []Interceptor
+	// Retry retries failed queries after Interceptors, nil means no retries.
+	Retry *RetryPolicy
+	// CircuitBreaker fails queries fast while the box is failing, it is applied to every attempt of Retry.
+	// Connections with the same CircuitBreaker share its state, ReplicaSet makes a copy per box.
+	CircuitBreaker *CircuitBreaker
+	// Hedge makes ReplicaSet send slow Select to another replica, nil means no hedging.
+	Hedge *HedgePolicy
 }
 
 type QueryOptions struct {
 	Timeout time.Duration
+	// Idempotent marks the query as safe to retry, see WithIdempotent.
+	Idempotent bool
+	// HedgeDelay overrides HedgePolicy.Delay of Select done by ReplicaSet, see WithHedgeDelay.
+	HedgeDelay time.Duration
 }
 
-type IConnection interface {
+// IMemcache is the memcache part of IConnection.
+// It is implemented over iproto by Connection and over memcached text protocol by MemcacheClient.
+//
+// Iproto of Tarantool 1.5 has no conditional update, so over iproto MemCAS, MemAppend, MemPrepend,
+// MemIncr, MemDecr, MemTouch and MemAdd of expired item read the item and write it back by separate
+// requests: a concurrent write between them is overwritten. MemcacheClient does them atomically
+// by the memcached port of the box, use it when items are changed concurrently.
+type IMemcache interface {
 	MemGet(key string) ([]byte, error)
+	MemGetItem(key string) (*MemItem, error)
+	MemGetMulti(keys []string) (map[string][]byte, error)
 	MemSet(key string, value []byte, expires uint32) error
+	MemSetItem(key string, item *MemItem) error
+	MemCAS(key string, value []byte, expires uint32, cas uint64) (bool, error)
+	MemAdd(key string, value []byte, expires uint32) (bool, error)
+	MemReplace(key string, value []byte, expires uint32) (bool, error)
+	MemAppend(key string, value []byte) (bool, error)
+	MemPrepend(key string, value []byte) (bool, error)
+	MemIncr(key string, delta uint64) (uint64, bool, error)
+	MemDecr(key string, delta uint64) (uint64, bool, error)
+	MemTouch(key string, expires uint32) (bool, error)
 	MemDelete(key string) error
+	MemDeleteMulti(keys []string) error
+}
+
+type IConnection interface {
+	IMemcache
 	Exec(ctx context.Context, q Query) (result []Tuple, err error)
 	ExecuteOptions(q Query, opts *QueryOptions) (result []Tuple, err error)
 	Execute(q Query) (result []Tuple, err error)
@@ -166,55 +266,83 @@ type IConnection interface {
 }
 
 type Connection struct {
+	executor
 	addr        string
-	requestID   uint32
 	requests    *requestMap
 	requestChan chan *request
 	closeOnce   sync.Once
 	exit        chan bool
 	closed      chan bool
 	tcpConn     net.Conn
-	memcacheCas uint64
+	err         error
+	inFlight    chan struct{}
+	// graceful shutdown
+	drainMu   sync.RWMutex
+	drainOnce sync.Once
+	draining  chan bool
+	active    sync.WaitGroup
 	// options
-	queryTimeout  time.Duration
-	memcacheSpace interface{}
-	defaultSpace  uint32
+	queryTimeout time.Duration
+	defaultSpace uint32
+	logger       Logger
+	failFast     bool
 }
 
 // Connection implements IConnection
 var _ IConnection = &Connection{}
 
-// Exec does the q query with context.
-func (conn *Connection) Exec(ctx context.Context, q Query) (result []Tuple, err error) {
-	var opts *QueryOptions
-	if deadline, ok := ctx.Deadline(); ok {
-		opts = &QueryOptions{Timeout: time.Until(deadline)}
-	}
-	return conn.ExecuteOptions(q, opts)
-}
-
-func (conn *Connection) ExecuteOptions(q Query, opts *QueryOptions) (result []Tuple, err error) {
-	reqID, request, err := conn.newRequest(q)
-	if err != nil {
-		return
-	}
-
-	if old := conn.requests.Put(reqID, request); old != nil {
-		// ouroboros has happened
-		old.replyChan <- &Response{Error: ErrShredOldRequests}
+// execute does the query with the context deadline as timeout or with queryTimeout.
+// Canceled query fails with ctx.Err() and its late reply is dropped. It is the invoker of interceptors.
+func (conn *Connection) execute(ctx context.Context, q Query) (result []Tuple, err error) {
+	conn.drainMu.RLock()
+	select {
+	case <-conn.draining:
+		conn.drainMu.RUnlock()
+		return nil, ErrConnectionClosed
+	default:
+		conn.active.Add(1)
+		conn.drainMu.RUnlock()
 	}
+	defer conn.active.Done()
 
-	var timeout time.Duration
-	if opts != nil && opts.Timeout > 0 {
-		timeout = opts.Timeout
-	} else {
-		timeout = conn.queryTimeout
+	timeout := conn.queryTimeout
+	if ctxDeadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(ctxDeadline); timeout <= 0 {
+			return nil, ErrRequestTimeout
+		}
 	}
 
 	// set execute deadline
 	deadline := acquireTimer(timeout)
 	defer releaseTimer(deadline)
 
+	if conn.inFlight != nil {
+		select {
+		case conn.inFlight <- struct{}{}:
+			// pass
+		default:
+			if conn.failFast {
+				return nil, ErrTooManyRequests
+			}
+			select {
+			case conn.inFlight <- struct{}{}:
+				// pass
+			case <-deadline.C:
+				return nil, ErrRequestTimeout
+			case <-ctx.Done():
+				return nil, contextError(ctx, ErrRequestTimeout)
+			case <-conn.exit:
+				return nil, conn.closedError()
+			}
+		}
+		defer func() { <-conn.inFlight }()
+	}
+
+	reqID, request, err := conn.newRequest(q)
+	if err != nil {
+		return
+	}
+
 	select {
 	case conn.requestChan <- request:
 		// pass
@@ -224,8 +352,13 @@ func (conn *Connection) ExecuteOptions(q Query, opts *QueryOptions) (result []Tu
 			conn.releaseRequest(request)
 		}
 		return nil, ErrRequestTimeout
+	case <-ctx.Done():
+		if request := conn.requests.Pop(reqID); request != nil {
+			conn.releaseRequest(request)
+		}
+		return nil, contextError(ctx, ErrRequestTimeout)
 	case <-conn.exit:
-		return nil, ErrConnectionClosed
+		return nil, conn.closedError()
 	}
 
 	select {
@@ -233,9 +366,15 @@ func (conn *Connection) ExecuteOptions(q Query, opts *QueryOptions) (result []Tu
 		conn.releaseRequest(request)
 		return response.Data, response.Error
 	case <-deadline.C:
+		// request ID is never reused before the ring turns over, so late reply will be dropped.
+		// Request isn't released to the pool, as writer may not have sent it yet.
+		conn.requests.Pop(reqID)
 		return nil, ErrResponseTimeout
+	case <-ctx.Done():
+		conn.requests.Pop(reqID)
+		return nil, contextError(ctx, ErrResponseTimeout)
 	case <-conn.exit:
-		return nil, ErrConnectionClosed
+		return nil, conn.closedError()
 	}
 }
 
@@ -243,15 +382,71 @@ func (conn *Connection) Execute(q Query) (result []Tuple, err error) {
 	return conn.ExecuteOptions(q, nil)
 }
 
+// contextError returns timeoutErr if ctx has expired and ctx.Err() if it has been canceled.
+func contextError(ctx context.Context, timeoutErr error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return timeoutErr
+	}
+	return ctx.Err()
+}
+
 func (conn *Connection) Close() {
-	conn.stop()
+	conn.stop(nil)
 	<-conn.closed
 }
 
+// Shutdown gracefully closes the connection. New queries fail with ErrConnectionClosed at once,
+// while queries in progress are waiting for their replies until ctx is done.
+// Then the socket is closed and ctx.Err() is returned if some queries were interrupted.
+func (conn *Connection) Shutdown(ctx context.Context) error {
+	conn.drainMu.Lock()
+	conn.drainOnce.Do(func() {
+		close(conn.draining)
+	})
+	conn.drainMu.Unlock()
+
+	drained := make(chan bool)
+	go func() {
+		conn.active.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+		// pass
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-conn.exit:
+		err = conn.err
+	}
+
+	conn.stop(nil)
+	<-conn.closed
+	return err
+}
+
+// Err returns the error that caused the connection close.
+// It returns nil while connection is open and ErrConnectionClosed if it was closed by Close.
+func (conn *Connection) Err() error {
+	select {
+	case <-conn.exit:
+		if conn.err == nil {
+			return ErrConnectionClosed
+		}
+		return conn.err
+	default:
+		return nil
+	}
+}
+
+// IsClosed returns true if connection is closed or shutting down.
 func (conn *Connection) IsClosed() bool {
 	select {
 	case <-conn.exit:
 		return true
+	case <-conn.draining:
+		return true
 	default:
 		return false
 	}
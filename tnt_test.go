@@ -2,11 +2,14 @@ package tnt
 
 import (
 	"flag"
+	"io"
+	"net"
 	"os"
 	"testing"
 )
 
 var testTntPrimaryPort int
+var testTntMemcachePort int
 
 type testingT interface {
 	SkipNow()
@@ -22,7 +25,57 @@ func setUp(t testingT) (int, func()) {
 
 func TestMain(t *testing.M) {
 	flag.IntVar(&testTntPrimaryPort, "test.tarantool_primary_port", 2001, "primary port for test tarantool")
+	flag.IntVar(&testTntMemcachePort, "test.tarantool_memcache_port", 2003, "memcached port for test tarantool")
 	flag.Parse()
 
 	os.Exit(t.Run())
 }
+
+// fakeServer serves iproto connections accepted on listener.
+// handler returns the reply body for every request, nil body means no reply.
+func fakeServer(listener net.Listener, handler func(requestType uint32, body []byte) []byte) {
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go fakeServe(c, handler)
+	}
+}
+
+// fakeServe serves single iproto connection, see fakeServer.
+func fakeServe(c net.Conn, handler func(requestType uint32, body []byte) []byte) {
+	defer c.Close()
+	header := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(c, header); err != nil {
+			return
+		}
+		body := make([]byte, UnpackInt(header[4:8]))
+		if _, err := io.ReadFull(c, body); err != nil {
+			return
+		}
+		reply := handler(UnpackInt(header[0:4]), body)
+		if reply == nil {
+			continue
+		}
+		copy(header[4:8], PackInt(uint32(len(reply))))
+		if _, err := c.Write(append(header, reply...)); err != nil {
+			return
+		}
+	}
+}
+
+// emptyReply is a successful reply body without tuples.
+var emptyReply = []byte{0, 0, 0, 0, 0, 0, 0, 0}
+
+// tuplesReply is a successful reply body with given tuples.
+func tuplesReply(tuples ...Tuple) []byte {
+	body := append(PackInt(0), PackInt(uint32(len(tuples)))...)
+	for _, tuple := range tuples {
+		packed := packTuple(tuple)
+		body = append(body, PackInt(uint32(len(packed)-4))...)
+		body = append(body, packed...)
+	}
+	return body
+}
@@ -0,0 +1,352 @@
+package tnttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lomik/go-tnt"
+)
+
+// MemcacheSpace is the memcache space of MemConnection, the same as the box default.
+const MemcacheSpace = 23
+
+// Proc is the stored procedure of MemConnection. It may query the connection.
+type Proc func(args tnt.Tuple) ([]tnt.Tuple, error)
+
+// QueryFault is injected into queries of MemConnection by InjectFault.
+type QueryFault struct {
+	// Match selects affected queries, nil matches every query.
+	Match func(q tnt.Query) bool
+	// Delay is waited before the query is done or failed.
+	// Query fails with tnt.ErrResponseTimeout if its context expires meanwhile.
+	Delay time.Duration
+	// Err is returned instead of doing the query, nil means the query is done after Delay.
+	Err error
+	// Times is the number of affected queries, 0 means every matching query.
+	Times int
+}
+
+// MemConnection is in-memory tnt.IConnection without sockets for unit tests.
+// Spaces behave like the box ones: unique and non-unique HASH and TREE indexes,
+// Select by Value, Values or Tuples with Limit and Offset, all the update operations,
+// ReturnTuple and box error codes, e.g. tnt.ErrCodeTupleFound for duplicate keys.
+// Mem* methods work with the MemcacheSpace, which is always present.
+type MemConnection struct {
+	tnt.IMemcache
+
+	mu           sync.Mutex
+	spaces       map[uint32]*memSpace
+	defaultSpace uint32
+	procs        map[string]Proc
+	faults       []*QueryFault
+	closed       bool
+}
+
+var _ tnt.IConnection = (*MemConnection)(nil)
+
+var memcacheSpaceConfig = tnt.SpaceConfig{
+	ID: MemcacheSpace,
+	Indexes: []tnt.IndexConfig{
+		{Type: tnt.Hash, Unique: true, Parts: []tnt.Part{{Field: 0, Type: tnt.Str}}},
+	},
+}
+
+// NewMemConnection returns connection with empty spaces described by schema, which may be nil.
+// Spaces must have indexes and are validated as tnt.BoxConfig ones, except that secondary HASH indexes may be non-unique.
+func NewMemConnection(schema *tnt.Schema) (*MemConnection, error) {
+	m := &MemConnection{
+		spaces: make(map[uint32]*memSpace),
+		procs:  make(map[string]Proc),
+	}
+
+	if schema != nil {
+		if err := validateSchema(schema); err != nil {
+			return nil, err
+		}
+		for _, space := range schema.Spaces {
+			m.spaces[space.ID] = &memSpace{config: space}
+		}
+	}
+	m.spaces[MemcacheSpace] = &memSpace{config: memcacheSpaceConfig}
+
+	m.IMemcache = tnt.NewMemcache(m.Execute, uint32(MemcacheSpace))
+	return m, nil
+}
+
+// validateSchema validates spaces by tnt.BoxConfig, which doesn't allow non-unique HASH indexes.
+// They are checked as TREE ones, as the rest of the checks is the same.
+func validateSchema(schema *tnt.Schema) error {
+	spaces := make([]tnt.SpaceConfig, len(schema.Spaces))
+	for i, space := range schema.Spaces {
+		indexes := make([]tnt.IndexConfig, len(space.Indexes))
+		for j, index := range space.Indexes {
+			if index.Type == tnt.Hash && !index.Unique {
+				index.Type = tnt.Tree
+			}
+			indexes[j] = index
+		}
+		space.Indexes = indexes
+		spaces[i] = space
+	}
+	config := &tnt.BoxConfig{Spaces: spaces, MemcachedSpace: MemcacheSpace}
+	return config.Validate()
+}
+
+// SetDefaultSpace sets space of queries without Space, 0 by default.
+func (m *MemConnection) SetDefaultSpace(space uint32) {
+	m.mu.Lock()
+	m.defaultSpace = space
+	m.mu.Unlock()
+}
+
+// RegisterProc makes proc available for Call by name.
+func (m *MemConnection) RegisterProc(name string, proc Proc) {
+	m.mu.Lock()
+	m.procs[name] = proc
+	m.mu.Unlock()
+}
+
+// InjectFault adds fault to matching queries. Faults are checked in order of injection,
+// the first matching one is applied.
+func (m *MemConnection) InjectFault(fault QueryFault) {
+	m.mu.Lock()
+	m.faults = append(m.faults, &fault)
+	m.mu.Unlock()
+}
+
+// ResetFaults removes all the injected faults.
+func (m *MemConnection) ResetFaults() {
+	m.mu.Lock()
+	m.faults = nil
+	m.mu.Unlock()
+}
+
+// Tuples returns copy of space tuples in primary key order.
+func (m *MemConnection) Tuples(space uint32) []tnt.Tuple {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.spaces[space]
+	if s == nil {
+		return nil
+	}
+	return copyTuples(s.all())
+}
+
+// fault returns fault matching q and counts it.
+func (m *MemConnection) fault(q tnt.Query) *QueryFault {
+	m.mu.Lock()
+	faults := append([]*QueryFault(nil), m.faults...)
+	m.mu.Unlock()
+
+	// Match may query the connection, so it is called unlocked
+	for _, fault := range faults {
+		if fault.Match != nil && !fault.Match(q) {
+			continue
+		}
+		if m.takeFault(fault) {
+			return fault
+		}
+	}
+	return nil
+}
+
+// takeFault counts use of the fault, it returns false if the fault has been removed meanwhile.
+func (m *MemConnection) takeFault(fault *QueryFault) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, f := range m.faults {
+		if f != fault {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				m.faults = append(m.faults[:i:i], m.faults[i+1:]...)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Exec does the q query with context. Like Connection, it fails with tnt.ErrRequestTimeout
+// if the deadline has passed already, otherwise the deadline is respected by delays of injected faults only.
+// Successful query returns non-nil slice, empty if there are no tuples.
+func (m *MemConnection) Exec(ctx context.Context, q tnt.Query) ([]tnt.Tuple, error) {
+	if m.IsClosed() {
+		return nil, tnt.ErrConnectionClosed
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= 0 {
+		return nil, tnt.ErrRequestTimeout
+	}
+
+	if fault := m.fault(q); fault != nil {
+		if fault.Delay > 0 {
+			timer := time.NewTimer(fault.Delay)
+			select {
+			case <-timer.C:
+				// pass
+			case <-ctx.Done():
+				timer.Stop()
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return nil, tnt.ErrResponseTimeout
+				}
+				return nil, ctx.Err()
+			}
+		}
+		if fault.Err != nil {
+			return nil, fault.Err
+		}
+	}
+
+	m.mu.Lock()
+	defaultSpace := m.defaultSpace
+	m.mu.Unlock()
+
+	// packing does the same checks and conversions as for the box
+	packed, err := q.Pack(0, defaultSpace)
+	if err != nil {
+		return nil, tnt.NewQueryError(err.Error())
+	}
+	query, err := tnt.UnpackQuery(tnt.UnpackInt(packed[0:4]), packed[12:])
+	if err != nil {
+		return nil, err
+	}
+
+	switch query := query.(type) {
+	case *tnt.Ping:
+		return []tnt.Tuple{}, nil
+	case *tnt.Call:
+		return m.call(query)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []tnt.Tuple
+	switch query := query.(type) {
+	case *tnt.Select:
+		s, err := m.space(query.Space)
+		if err != nil {
+			return nil, err
+		}
+		result, err = s.query(query.Index, query.Tuples, query.Offset, query.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return copyTuples(result), nil
+	case *tnt.Insert:
+		s, err := m.space(query.Space)
+		if err != nil {
+			return nil, err
+		}
+		result, err = s.insert(copyTuple(query.Tuple), query.Mode)
+		if err != nil {
+			return nil, err
+		}
+		if !query.ReturnTuple {
+			result = nil
+		}
+	case *tnt.Update:
+		s, err := m.space(query.Space)
+		if err != nil {
+			return nil, err
+		}
+		result, err = s.update(query.Tuple, query.Ops)
+		if err != nil {
+			return nil, err
+		}
+		if !query.ReturnTuple {
+			result = nil
+		}
+	case *tnt.Delete:
+		s, err := m.space(query.Space)
+		if err != nil {
+			return nil, err
+		}
+		result, err = s.delete(query.Tuple)
+		if err != nil {
+			return nil, err
+		}
+		if !query.ReturnTuple {
+			result = nil
+		}
+	}
+	return copyTuples(result), nil
+}
+
+func (m *MemConnection) space(id interface{}) (*memSpace, error) {
+	s := m.spaces[id.(uint32)]
+	if s == nil {
+		return nil, tnt.NewQueryErrorCode(tnt.ErrCodeNoSuchSpace, fmt.Sprintf("Space %d does not exist", id))
+	}
+	return s, nil
+}
+
+func (m *MemConnection) call(q *tnt.Call) ([]tnt.Tuple, error) {
+	m.mu.Lock()
+	proc := m.procs[string(q.Name)]
+	m.mu.Unlock()
+
+	if proc == nil {
+		return nil, tnt.NewQueryErrorCode(tnt.ErrCodeNoSuchProc, fmt.Sprintf("Procedure '%s' is not defined", q.Name))
+	}
+
+	result, err := proc(copyTuple(q.Tuple))
+	if err != nil {
+		return nil, err
+	}
+	if !q.ReturnTuple {
+		return []tnt.Tuple{}, nil
+	}
+	return copyTuples(result), nil
+}
+
+func (m *MemConnection) ExecuteOptions(q tnt.Query, opts *tnt.QueryOptions) ([]tnt.Tuple, error) {
+	ctx := context.Background()
+	if opts != nil && opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	return m.Exec(ctx, q)
+}
+
+func (m *MemConnection) Execute(q tnt.Query) ([]tnt.Tuple, error) {
+	return m.ExecuteOptions(q, nil)
+}
+
+// Close makes queries fail with tnt.ErrConnectionClosed, data are kept.
+func (m *MemConnection) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+}
+
+func (m *MemConnection) IsClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+func copyTuple(tuple tnt.Tuple) tnt.Tuple {
+	c := make(tnt.Tuple, len(tuple))
+	for i, field := range tuple {
+		c[i] = append(tnt.Bytes{}, field...)
+	}
+	return c
+}
+
+// copyTuples returns non-nil copy as Connection returns non-nil result.
+func copyTuples(tuples []tnt.Tuple) []tnt.Tuple {
+	c := make([]tnt.Tuple, len(tuples))
+	for i, tuple := range tuples {
+		c[i] = copyTuple(tuple)
+	}
+	return c
+}
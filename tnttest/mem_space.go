@@ -0,0 +1,394 @@
+package tnttest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lomik/go-tnt"
+)
+
+// errCodeIllegalParams is the box error code of malformed requests, e.g. key of wrong type.
+const errCodeIllegalParams = 0x02
+
+func illegalParams(format string, args ...interface{}) error {
+	return tnt.NewQueryErrorCode(errCodeIllegalParams, fmt.Sprintf(format, args...))
+}
+
+// memSpace keeps tuples unordered, indexes are emulated by scans.
+type memSpace struct {
+	config tnt.SpaceConfig
+	tuples []tnt.Tuple
+}
+
+// checkField checks size of field of NUM and NUM64 key parts.
+// Key of NUM64 part may be NUM as well, tuple field may not.
+func checkField(t tnt.FieldType, field tnt.Bytes, isKey bool) error {
+	switch {
+	case t == tnt.Num && len(field) != 4:
+		return errors.New("expected NUM")
+	case t == tnt.Num64 && len(field) != 8 && !(isKey && len(field) == 4):
+		return errors.New("expected NUM64")
+	}
+	return nil
+}
+
+func unpackNum(field tnt.Bytes) uint64 {
+	if len(field) == 4 {
+		return uint64(tnt.UnpackInt(field))
+	}
+	return tnt.UnpackLong(field)
+}
+
+func compareField(t tnt.FieldType, a, b tnt.Bytes) int {
+	if t == tnt.Str {
+		return bytes.Compare(a, b)
+	}
+	x, y := unpackNum(a), unpackNum(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compareKey compares key with the first len(key) parts of the tuple key.
+func (s *memSpace) compareKey(index uint32, tuple tnt.Tuple, key tnt.Tuple) int {
+	for i, part := range s.config.Indexes[index].Parts[:len(key)] {
+		if c := compareField(part.Type, tuple[part.Field], key[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (s *memSpace) key(index uint32, tuple tnt.Tuple) tnt.Tuple {
+	parts := s.config.Indexes[index].Parts
+	key := make(tnt.Tuple, len(parts))
+	for i, part := range parts {
+		key[i] = tuple[part.Field]
+	}
+	return key
+}
+
+// checkKey checks key for search, partial keys are allowed by TREE index only.
+func (s *memSpace) checkKey(index uint32, key tnt.Tuple, exact bool) error {
+	config := s.config.Indexes[index]
+	if len(key) > len(config.Parts) {
+		return illegalParams("Key part count %d is greater than index part count %d", len(key), len(config.Parts))
+	}
+	if (exact || config.Type == tnt.Hash) && len(key) != len(config.Parts) {
+		return illegalParams("Invalid key part count in an exact match (expected %d, got %d)", len(config.Parts), len(key))
+	}
+	for i, field := range key {
+		if err := checkField(config.Parts[i].Type, field, true); err != nil {
+			return illegalParams("Supplied key field type does not match index type: %s", err)
+		}
+	}
+	return nil
+}
+
+// checkTuple checks cardinality and fields of all the indexes.
+func (s *memSpace) checkTuple(tuple tnt.Tuple) error {
+	if s.config.Cardinality != 0 && uint32(len(tuple)) != s.config.Cardinality {
+		return illegalParams("Tuple field count %d does not match space %d cardinality %d", len(tuple), s.config.ID, s.config.Cardinality)
+	}
+	for _, index := range s.config.Indexes {
+		for _, part := range index.Parts {
+			if int(part.Field) >= len(tuple) {
+				return illegalParams("Tuple must have at least %d fields", part.Field+1)
+			}
+			if err := checkField(part.Type, tuple[part.Field], false); err != nil {
+				return illegalParams("Tuple field %d type does not match one required by operation: %s", part.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// find returns position of tuple with the full primary key or -1.
+func (s *memSpace) find(key tnt.Tuple) int {
+	for i, tuple := range s.tuples {
+		if s.compareKey(0, tuple, key) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkUnique checks that tuple doesn't duplicate keys of unique indexes, tuple at skip position is ignored.
+func (s *memSpace) checkUnique(tuple tnt.Tuple, skip int) error {
+	for index, config := range s.config.Indexes {
+		if !config.Unique {
+			continue
+		}
+		key := s.key(uint32(index), tuple)
+		for i, other := range s.tuples {
+			if i != skip && s.compareKey(uint32(index), other, key) == 0 {
+				return tnt.NewQueryErrorCode(tnt.ErrCodeTupleFound, fmt.Sprintf("Duplicate key exists in unique index %d", index))
+			}
+		}
+	}
+	return nil
+}
+
+// sorted returns tuples in order of index, ties of non-unique index are ordered by primary key.
+func (s *memSpace) sorted(index uint32, tuples []tnt.Tuple) []tnt.Tuple {
+	sort.SliceStable(tuples, func(i, j int) bool {
+		c := s.compareKey(index, tuples[i], s.key(index, tuples[j]))
+		if c == 0 {
+			c = s.compareKey(0, tuples[i], s.key(0, tuples[j]))
+		}
+		return c < 0
+	})
+	return tuples
+}
+
+// all returns all the tuples in primary key order.
+func (s *memSpace) all() []tnt.Tuple {
+	return s.sorted(0, append([]tnt.Tuple(nil), s.tuples...))
+}
+
+// query selects tuples of all the keys, offset and limit are applied to the whole result like the box does.
+func (s *memSpace) query(index uint32, keys []tnt.Tuple, offset uint32, limit uint32) ([]tnt.Tuple, error) {
+	if int(index) >= len(s.config.Indexes) {
+		return nil, illegalParams("No index #%d is defined in space %d", index, s.config.ID)
+	}
+
+	var result []tnt.Tuple
+	for _, key := range keys {
+		if err := s.checkKey(index, key, false); err != nil {
+			return nil, err
+		}
+
+		var found []tnt.Tuple
+		for _, tuple := range s.tuples {
+			if s.compareKey(index, tuple, key) == 0 {
+				found = append(found, tuple)
+			}
+		}
+		for _, tuple := range s.sorted(index, found) {
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if uint32(len(result)) == limit {
+				return result, nil
+			}
+			result = append(result, tuple)
+		}
+	}
+	return result, nil
+}
+
+func (s *memSpace) insert(tuple tnt.Tuple, mode tnt.InsertMode) ([]tnt.Tuple, error) {
+	if err := s.checkTuple(tuple); err != nil {
+		return nil, err
+	}
+
+	pos := s.find(s.key(0, tuple))
+	switch {
+	case mode&tnt.InsertAdd != 0 && pos >= 0:
+		return nil, tnt.NewQueryErrorCode(tnt.ErrCodeTupleFound, "Duplicate key exists in unique index 0")
+	case mode&tnt.InsertReplace != 0 && pos < 0:
+		return nil, tnt.NewQueryErrorCode(tnt.ErrCodeTupleNotFound, "Tuple doesn't exist in index 0")
+	}
+
+	if err := s.checkUnique(tuple, pos); err != nil {
+		return nil, err
+	}
+
+	if pos >= 0 {
+		s.tuples[pos] = tuple
+	} else {
+		s.tuples = append(s.tuples, tuple)
+	}
+	return []tnt.Tuple{tuple}, nil
+}
+
+func (s *memSpace) update(key tnt.Tuple, ops []tnt.Operator) ([]tnt.Tuple, error) {
+	if err := s.checkKey(0, key, true); err != nil {
+		return nil, err
+	}
+
+	pos := s.find(key)
+	if pos < 0 {
+		return nil, nil
+	}
+
+	tuple := copyTuple(s.tuples[pos])
+	for _, op := range ops {
+		var err error
+		if tuple, err = applyOp(tuple, op); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.checkTuple(tuple); err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(tuple, pos); err != nil {
+		return nil, err
+	}
+
+	s.tuples[pos] = tuple
+	return []tnt.Tuple{tuple}, nil
+}
+
+func (s *memSpace) delete(key tnt.Tuple) ([]tnt.Tuple, error) {
+	if err := s.checkKey(0, key, true); err != nil {
+		return nil, err
+	}
+
+	pos := s.find(key)
+	if pos < 0 {
+		return nil, nil
+	}
+
+	tuple := s.tuples[pos]
+	s.tuples = append(s.tuples[:pos], s.tuples[pos+1:]...)
+	return []tnt.Tuple{tuple}, nil
+}
+
+// applyOp returns tuple changed by the update operation.
+// Set of the field next to the last one appends it.
+func applyOp(tuple tnt.Tuple, op tnt.Operator) (tnt.Tuple, error) {
+	field := int(op.Field)
+	noField := illegalParams("Field %d was not found in the tuple", field)
+
+	switch op.OpCode {
+	case tnt.OpCodeSet:
+		if field > len(tuple) {
+			return nil, noField
+		}
+		if field == len(tuple) {
+			return append(tuple, op.Value), nil
+		}
+		tuple[field] = op.Value
+	case tnt.OpCodeInsert:
+		if field > len(tuple) {
+			return nil, noField
+		}
+		tuple = append(tuple, nil)
+		copy(tuple[field+1:], tuple[field:])
+		tuple[field] = op.Value
+	case tnt.OpCodeDelete:
+		if field >= len(tuple) {
+			return nil, noField
+		}
+		tuple = append(tuple[:field], tuple[field+1:]...)
+	case tnt.OpCodeAdd, tnt.OpCodeAnd, tnt.OpCodeXor, tnt.OpCodeOr:
+		if field >= len(tuple) {
+			return nil, noField
+		}
+		value, err := arithmetic(op.OpCode, tuple[field], op.Value)
+		if err != nil {
+			return nil, illegalParams("Field %d type does not match one required by operation: %s", field, err)
+		}
+		tuple[field] = value
+	case tnt.OpCodeSplice:
+		if field >= len(tuple) {
+			return nil, noField
+		}
+		value, err := splice(tuple[field], op.Value)
+		if err != nil {
+			return nil, illegalParams("Field SPLICE error: %s", err)
+		}
+		tuple[field] = value
+	default:
+		return nil, illegalParams("Unknown update operation %d", op.OpCode)
+	}
+	return tuple, nil
+}
+
+// arithmetic applies op to NUM or NUM64 field, argument of NUM64 field may be NUM.
+func arithmetic(op tnt.OpCode, field tnt.Bytes, arg tnt.Bytes) (tnt.Bytes, error) {
+	if len(field) != 4 && len(field) != 8 {
+		return nil, errors.New("expected NUM or NUM64")
+	}
+	if len(arg) != 4 && !(len(field) == 8 && len(arg) == 8) {
+		return nil, fmt.Errorf("argument of %d bytes", len(arg))
+	}
+
+	x, y := unpackNum(field), unpackNum(arg)
+	switch op {
+	case tnt.OpCodeAdd:
+		x += y
+	case tnt.OpCodeAnd:
+		x &= y
+	case tnt.OpCodeXor:
+		x ^= y
+	case tnt.OpCodeOr:
+		x |= y
+	}
+
+	if len(field) == 4 {
+		return tnt.PackInt(uint32(x)), nil
+	}
+	return tnt.PackLong(x), nil
+}
+
+// readField decodes varint-prefixed field and returns the rest of p.
+func readField(p []byte) (tnt.Bytes, []byte, error) {
+	var length uint32
+	for i := 0; i < len(p) && i < 5; i++ {
+		length = length<<7 | uint32(p[i]&0x7f)
+		if p[i]&0x80 == 0 {
+			p = p[i+1:]
+			if uint64(length) > uint64(len(p)) {
+				break
+			}
+			return p[:length], p[length:], nil
+		}
+	}
+	return nil, nil, errors.New("argument is too short")
+}
+
+// splice replaces part of field like the box does, arg is packed by tnt.OpSplice.
+func splice(field tnt.Bytes, arg tnt.Bytes) (tnt.Bytes, error) {
+	offsetField, p, err := readField(arg)
+	if err != nil {
+		return nil, err
+	}
+	lengthField, p, err := readField(p)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := readField(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(offsetField) != 4 || len(lengthField) != 4 {
+		return nil, errors.New("offset and length must be NUM")
+	}
+
+	size := len(field)
+	offset := int(int32(tnt.UnpackInt(offsetField)))
+	length := int(int32(tnt.UnpackInt(lengthField)))
+
+	switch {
+	case offset < 0 && -offset > size:
+		return nil, errors.New("offset is out of bound")
+	case offset < 0:
+		offset += size
+	case offset > size:
+		offset = size
+	}
+
+	switch {
+	case length < 0 && -length > size-offset:
+		length = 0
+	case length < 0:
+		length += size - offset
+	case length > size-offset:
+		length = size - offset
+	}
+
+	result := make(tnt.Bytes, 0, size-length+len(value))
+	result = append(result, field[:offset]...)
+	result = append(result, value...)
+	return append(result, field[offset+length:]...), nil
+}
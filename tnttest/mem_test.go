@@ -0,0 +1,365 @@
+package tnttest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lomik/go-tnt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// users are (id NUM, email STR, city STR, visits NUM64) with unique HASH email and non-unique TREE city
+var usersSchema = &tnt.Schema{Spaces: []tnt.SpaceConfig{{
+	ID: 1,
+	Indexes: []tnt.IndexConfig{
+		{Type: tnt.Tree, Unique: true, Parts: []tnt.Part{{Field: 0, Type: tnt.Num}}},
+		{Type: tnt.Hash, Unique: true, Parts: []tnt.Part{{Field: 1, Type: tnt.Str}}},
+		{Type: tnt.Tree, Unique: false, Parts: []tnt.Part{{Field: 2, Type: tnt.Str}}},
+	},
+}}}
+
+func user(id uint32, email string, city string, visits uint64) tnt.Tuple {
+	return tnt.Tuple{tnt.PackInt(id), tnt.Bytes(email), tnt.Bytes(city), tnt.PackLong(visits)}
+}
+
+func queryErrorCode(err error) uint32 {
+	var queryErr *tnt.QueryError
+	if errors.As(err, &queryErr) {
+		return queryErr.Code
+	}
+	return 0
+}
+
+func newUsers(t *testing.T) *MemConnection {
+	conn, err := NewMemConnection(usersSchema)
+	require.NoError(t, err)
+	conn.SetDefaultSpace(1)
+
+	for _, tuple := range []tnt.Tuple{
+		user(3, "c@x", "paris", 0),
+		user(1, "a@x", "rome", 0),
+		user(2, "b@x", "paris", 0),
+		user(4, "d@x", "oslo", 0),
+	} {
+		_, err := conn.Execute(&tnt.Insert{Tuple: tuple})
+		require.NoError(t, err)
+	}
+	return conn
+}
+
+func TestMemConnectionSelect(t *testing.T) {
+	assert := assert.New(t)
+	conn := newUsers(t)
+
+	tuples, err := conn.Execute(&tnt.Select{Value: tnt.PackInt(2)})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(2, "b@x", "paris", 0)}, tuples)
+
+	// offset and limit are applied to the result of all the keys
+	tuples, err = conn.Execute(&tnt.Select{Values: []tnt.Bytes{tnt.PackInt(4), tnt.PackInt(5), tnt.PackInt(1), tnt.PackInt(3)}, Offset: 1, Limit: 2})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(1, "a@x", "rome", 0), user(3, "c@x", "paris", 0)}, tuples)
+
+	// non-unique TREE index is ordered by primary key inside the same key
+	tuples, err = conn.Execute(&tnt.Select{Value: tnt.Bytes("paris"), Index: 2})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(2, "b@x", "paris", 0), user(3, "c@x", "paris", 0)}, tuples)
+
+	// empty key of TREE index selects everything in order
+	tuples, err = conn.Execute(&tnt.Select{Tuples: []tnt.Tuple{{}}, Index: 2, Limit: 3})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(4, "d@x", "oslo", 0), user(2, "b@x", "paris", 0), user(3, "c@x", "paris", 0)}, tuples)
+
+	tuples, err = conn.Execute(&tnt.Select{Value: tnt.Bytes("d@x"), Index: 1})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(4, "d@x", "oslo", 0)}, tuples)
+
+	// HASH index needs the full key
+	_, err = conn.Execute(&tnt.Select{Tuples: []tnt.Tuple{{}}, Index: 1})
+	assert.Equal(uint32(errCodeIllegalParams), queryErrorCode(err))
+
+	_, err = conn.Execute(&tnt.Select{Value: tnt.Bytes("1")})
+	assert.Equal(uint32(errCodeIllegalParams), queryErrorCode(err))
+
+	_, err = conn.Execute(&tnt.Select{Value: tnt.PackInt(1), Space: 7})
+	assert.Equal(uint32(tnt.ErrCodeNoSuchSpace), queryErrorCode(err))
+
+	// result doesn't share memory with the space
+	tuples, _ = conn.Execute(&tnt.Select{Value: tnt.PackInt(1)})
+	tuples[0][1][0] = 'z'
+	assert.Equal(user(1, "a@x", "rome", 0), conn.Tuples(1)[0])
+}
+
+func TestMemConnectionInsert(t *testing.T) {
+	assert := assert.New(t)
+	conn := newUsers(t)
+
+	tuples, err := conn.Execute(&tnt.Insert{Tuple: user(1, "a@x", "milan", 0), ReturnTuple: true})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(1, "a@x", "milan", 0)}, tuples)
+
+	_, err = conn.Execute(&tnt.Insert{Tuple: user(1, "a@x", "milan", 0), Mode: tnt.InsertAdd})
+	assert.Equal(uint32(tnt.ErrCodeTupleFound), queryErrorCode(err))
+
+	_, err = conn.Execute(&tnt.Insert{Tuple: user(5, "e@x", "milan", 0), Mode: tnt.InsertReplace})
+	assert.Equal(uint32(tnt.ErrCodeTupleNotFound), queryErrorCode(err))
+
+	// duplicate of unique secondary key
+	_, err = conn.Execute(&tnt.Insert{Tuple: user(5, "a@x", "milan", 0)})
+	assert.Equal(uint32(tnt.ErrCodeTupleFound), queryErrorCode(err))
+	assert.Contains(err.Error(), "index 1")
+
+	tuples, err = conn.Execute(&tnt.Insert{Tuple: user(5, "e@x", "milan", 0), Mode: tnt.InsertAdd})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{}, tuples)
+
+	// NUM64 field must be 8 bytes
+	_, err = conn.Execute(&tnt.Insert{Tuple: tnt.Tuple{tnt.Bytes("6")}})
+	assert.Equal(uint32(errCodeIllegalParams), queryErrorCode(err))
+
+	assert.Len(conn.Tuples(1), 5)
+}
+
+func TestMemConnectionUpdate(t *testing.T) {
+	assert := assert.New(t)
+	conn := newUsers(t)
+
+	tuples, err := conn.Execute(&tnt.Update{
+		Tuple: tnt.Tuple{tnt.PackInt(1)},
+		Ops: []tnt.Operator{
+			tnt.OpAdd(3, tnt.PackInt(10)),
+			tnt.OpSplice(1, 1, 2, tnt.Bytes("@y.z")),
+			tnt.OpSet(4, tnt.Bytes("new")),
+			tnt.OpInsert(4, tnt.Bytes("first")),
+			tnt.OpDelete(5, nil),
+		},
+		ReturnTuple: true,
+	})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{append(user(1, "a@y.z", "rome", 10), tnt.Bytes("first"))}, tuples)
+
+	tuples, err = conn.Execute(&tnt.Update{
+		Tuple:       tnt.Tuple{tnt.PackInt(1)},
+		Ops:         []tnt.Operator{tnt.OpOr(3, tnt.PackInt(5)), tnt.OpAnd(3, tnt.PackLong(7)), tnt.OpXor(3, tnt.PackInt(1))},
+		ReturnTuple: true,
+	})
+	assert.NoError(err)
+	assert.Equal(tnt.Bytes(tnt.PackLong(6)), tuples[0][3])
+
+	// negative offset of splice counts from the end
+	tuples, err = conn.Execute(&tnt.Update{
+		Tuple:       tnt.Tuple{tnt.PackInt(1)},
+		Ops:         []tnt.Operator{tnt.OpSplice(2, -2, -1, tnt.Bytes("XX"))},
+		ReturnTuple: true,
+	})
+	assert.NoError(err)
+	assert.Equal(tnt.Bytes("roXXe"), tuples[0][2])
+
+	// missing tuple is not an error
+	tuples, err = conn.Execute(&tnt.Update{Tuple: tnt.Tuple{tnt.PackInt(9)}, Ops: []tnt.Operator{tnt.OpSet(1, nil)}, ReturnTuple: true})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{}, tuples)
+
+	// failed update doesn't change the tuple
+	_, err = conn.Execute(&tnt.Update{Tuple: tnt.Tuple{tnt.PackInt(1)}, Ops: []tnt.Operator{tnt.OpSet(2, nil), tnt.OpSet(1, tnt.Bytes("b@x"))}})
+	assert.Equal(uint32(tnt.ErrCodeTupleFound), queryErrorCode(err))
+
+	_, err = conn.Execute(&tnt.Update{Tuple: tnt.Tuple{tnt.PackInt(1)}, Ops: []tnt.Operator{tnt.OpAdd(2, tnt.PackInt(1))}})
+	assert.Equal(uint32(errCodeIllegalParams), queryErrorCode(err))
+
+	_, err = conn.Execute(&tnt.Update{Tuple: tnt.Tuple{tnt.PackInt(1)}, Ops: []tnt.Operator{tnt.OpDelete(9, nil)}})
+	assert.Equal(uint32(errCodeIllegalParams), queryErrorCode(err))
+
+	tuples, _ = conn.Execute(&tnt.Select{Value: tnt.PackInt(1)})
+	assert.Equal([]tnt.Tuple{append(user(1, "a@y.z", "roXXe", 6), tnt.Bytes("first"))}, tuples)
+}
+
+func TestMemConnectionDelete(t *testing.T) {
+	assert := assert.New(t)
+	conn := newUsers(t)
+
+	tuples, err := conn.Execute(&tnt.Delete{Tuple: tnt.Tuple{tnt.PackInt(2)}, ReturnTuple: true})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(2, "b@x", "paris", 0)}, tuples)
+
+	tuples, err = conn.Execute(&tnt.Delete{Tuple: tnt.Tuple{tnt.PackInt(2)}, ReturnTuple: true})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{}, tuples)
+
+	tuples, err = conn.Execute(&tnt.Select{Value: tnt.Bytes("paris"), Index: 2})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(3, "c@x", "paris", 0)}, tuples)
+}
+
+func TestMemConnectionCall(t *testing.T) {
+	assert := assert.New(t)
+	conn := newUsers(t)
+
+	// procedure may query the connection
+	conn.RegisterProc("users.by_city", func(args tnt.Tuple) ([]tnt.Tuple, error) {
+		return conn.Execute(&tnt.Select{Value: args[0], Index: 2})
+	})
+
+	tuples, err := conn.Execute(&tnt.Call{Name: tnt.Bytes("users.by_city"), Tuple: tnt.Tuple{tnt.Bytes("oslo")}, ReturnTuple: true})
+	assert.NoError(err)
+	assert.Equal([]tnt.Tuple{user(4, "d@x", "oslo", 0)}, tuples)
+
+	_, err = conn.Execute(&tnt.Call{Name: tnt.Bytes("missing")})
+	assert.Equal(uint32(tnt.ErrCodeNoSuchProc), queryErrorCode(err))
+
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.NoError(err)
+}
+
+func TestMemConnectionMemcache(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := NewMemConnection(nil)
+	require.NoError(t, err)
+
+	assert.NoError(conn.MemSet("counter", []byte("10"), 0))
+
+	value, err := conn.MemGet("counter")
+	assert.NoError(err)
+	assert.Equal([]byte("10"), value)
+
+	added, err := conn.MemAdd("counter", []byte("0"), 0)
+	assert.NoError(err)
+	assert.False(added)
+
+	n, ok, err := conn.MemIncr("counter", 5)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(uint64(15), n)
+
+	item, err := conn.MemGetItem("counter")
+	assert.NoError(err)
+	stored, err := conn.MemCAS("counter", []byte("1"), 0, item.CAS)
+	assert.NoError(err)
+	assert.True(stored)
+	stored, err = conn.MemCAS("counter", []byte("2"), 0, item.CAS)
+	assert.NoError(err)
+	assert.False(stored)
+
+	assert.NoError(conn.MemDelete("counter"))
+	value, err = conn.MemGet("counter")
+	assert.NoError(err)
+	assert.Nil(value)
+}
+
+func TestMemConnectionFaults(t *testing.T) {
+	assert := assert.New(t)
+	conn := newUsers(t)
+
+	isInsert := func(q tnt.Query) bool {
+		_, ok := q.(*tnt.Insert)
+		return ok
+	}
+
+	conn.InjectFault(QueryFault{Match: isInsert, Err: tnt.ErrConnectionClosed, Times: 2})
+	for i := 0; i < 2; i++ {
+		_, err := conn.Execute(&tnt.Insert{Tuple: user(5, "e@x", "milan", 0)})
+		assert.Equal(tnt.ErrConnectionClosed, err)
+	}
+	_, err := conn.Execute(&tnt.Select{Value: tnt.PackInt(1)})
+	assert.NoError(err)
+	_, err = conn.Execute(&tnt.Insert{Tuple: user(5, "e@x", "milan", 0)})
+	assert.NoError(err)
+
+	conn.InjectFault(QueryFault{Delay: time.Second})
+	_, err = conn.ExecuteOptions(&tnt.Ping{}, &tnt.QueryOptions{Timeout: 10 * time.Millisecond})
+	assert.Equal(tnt.ErrResponseTimeout, err)
+
+	// Mem* methods are affected as well
+	conn.ResetFaults()
+	conn.InjectFault(QueryFault{Err: tnt.ErrTooManyRequests, Times: 1})
+	assert.Equal(tnt.ErrTooManyRequests, conn.MemSet("key", []byte("value"), 0))
+	assert.NoError(conn.MemSet("key", []byte("value"), 0))
+
+	// Match may query the connection
+	conn.ResetFaults()
+	conn.InjectFault(QueryFault{Match: func(q tnt.Query) bool {
+		return len(conn.Tuples(1)) > 5
+	}, Err: tnt.ErrTooManyRequests})
+	_, err = conn.Execute(&tnt.Insert{Tuple: user(6, "f@x", "milan", 0)})
+	assert.NoError(err)
+	_, err = conn.Execute(&tnt.Insert{Tuple: user(7, "g@x", "milan", 0)})
+	assert.Equal(tnt.ErrTooManyRequests, err)
+
+	conn.Close()
+	assert.True(conn.IsClosed())
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.Equal(tnt.ErrConnectionClosed, err)
+}
+
+// results and errors are the same as of Connection
+func TestMemConnectionLikeConnection(t *testing.T) {
+	assert := assert.New(t)
+	conn := newUsers(t)
+
+	for _, q := range []tnt.Query{
+		&tnt.Ping{},
+		&tnt.Select{Value: tnt.PackInt(42)},
+		&tnt.Insert{Tuple: user(5, "e@x", "milan", 0)},
+		&tnt.Update{Tuple: tnt.Tuple{tnt.PackInt(42)}, Ops: []tnt.Operator{tnt.OpAdd(3, tnt.PackLong(1))}},
+		&tnt.Delete{Tuple: tnt.Tuple{tnt.PackInt(42)}},
+	} {
+		tuples, err := conn.Execute(q)
+		assert.NoError(err)
+		assert.Equal([]tnt.Tuple{}, tuples, "%T", q)
+	}
+
+	// packing errors are QueryError
+	_, err := conn.Execute(&tnt.Select{Value: tnt.PackInt(1), Space: "users"})
+	assert.IsType(&tnt.QueryError{}, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_, err = conn.Exec(ctx, &tnt.Ping{})
+	assert.Equal(tnt.ErrRequestTimeout, err)
+}
+
+func TestNewMemConnection(t *testing.T) {
+	_, err := NewMemConnection(&tnt.Schema{Spaces: []tnt.SpaceConfig{{ID: 1}}})
+	assert.Error(t, err)
+
+	_, err = NewMemConnection(&tnt.Schema{Spaces: []tnt.SpaceConfig{memcacheSpaceConfig}})
+	assert.Error(t, err)
+
+	// primary index must be unique
+	_, err = NewMemConnection(&tnt.Schema{Spaces: []tnt.SpaceConfig{{
+		ID:      1,
+		Indexes: []tnt.IndexConfig{{Type: tnt.Hash, Parts: []tnt.Part{{Field: 0, Type: tnt.Num}}}},
+	}}})
+	assert.Error(t, err)
+}
+
+func TestMemConnectionNonUniqueHash(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := NewMemConnection(&tnt.Schema{Spaces: []tnt.SpaceConfig{{
+		ID: 1,
+		Indexes: []tnt.IndexConfig{
+			{Type: tnt.Hash, Unique: true, Parts: []tnt.Part{{Field: 0, Type: tnt.Num}}},
+			{Type: tnt.Hash, Unique: false, Parts: []tnt.Part{{Field: 2, Type: tnt.Str}}},
+		},
+	}}})
+	require.NoError(t, err)
+	conn.SetDefaultSpace(1)
+
+	for _, tuple := range []tnt.Tuple{
+		user(1, "a@x", "rome", 0),
+		user(2, "b@x", "paris", 0),
+		user(3, "c@x", "paris", 0),
+	} {
+		_, err := conn.Execute(&tnt.Insert{Tuple: tuple})
+		assert.NoError(err)
+	}
+
+	tuples, err := conn.Execute(&tnt.Select{Value: tnt.Bytes("paris"), Index: 1})
+	assert.NoError(err)
+	assert.ElementsMatch([]tnt.Tuple{user(2, "b@x", "paris", 0), user(3, "c@x", "paris", 0)}, tuples)
+}
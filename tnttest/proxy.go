@@ -0,0 +1,239 @@
+// Package tnttest contains helpers for testing code which uses tnt.
+package tnttest
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Faults are injected by FaultProxy into proxied connections.
+// Changes made by SetFaults affect connections established already.
+type Faults struct {
+	// Latency delays every chunk of data read from either side.
+	Latency time.Duration
+	// Bandwidth limits bytes per second in each direction, 0 means unlimited.
+	Bandwidth int
+	// CloseAfter closes connection once it has passed so many bytes in both directions, 0 means never.
+	CloseAfter int64
+	// ResetAfter is the same as CloseAfter but client receives TCP RST instead of FIN.
+	ResetAfter int64
+	// SplitWrites forwards data by writes of at most so many bytes, 0 means as is.
+	SplitWrites int
+	// BlackHole swallows all the data keeping connections open.
+	BlackHole bool
+}
+
+// FaultProxy is a TCP proxy between client (e.g. tnt.Connection) and server (e.g. tnt.Box or a fake one),
+// which injects network faults.
+type FaultProxy struct {
+	listener net.Listener
+	target   string
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	faults Faults
+	conns  map[*proxyConn]bool
+	closed bool
+}
+
+// NewFaultProxy listens on random local port and proxies accepted connections to target.
+func NewFaultProxy(target string) (*FaultProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &FaultProxy{
+		listener: listener,
+		target:   target,
+		conns:    make(map[*proxyConn]bool),
+	}
+
+	p.wg.Add(1)
+	go p.accept()
+
+	return p, nil
+}
+
+// Addr is the address clients should connect to.
+func (p *FaultProxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// SetFaults replaces current faults.
+func (p *FaultProxy) SetFaults(faults Faults) {
+	p.mu.Lock()
+	p.faults = faults
+	p.mu.Unlock()
+}
+
+// Faults returns current faults.
+func (p *FaultProxy) Faults() Faults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults
+}
+
+// CloseConnections closes all proxied connections, new ones are accepted still.
+func (p *FaultProxy) CloseConnections() {
+	p.mu.Lock()
+	conns := make([]*proxyConn, 0, len(p.conns))
+	for c := range p.conns {
+		conns = append(conns, c)
+	}
+	p.mu.Unlock()
+
+	for _, c := range conns {
+		c.close(false)
+	}
+}
+
+// Close stops listening and closes all proxied connections.
+func (p *FaultProxy) Close() error {
+	// connection accepted meanwhile is closed by accept
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	err := p.listener.Close()
+	p.CloseConnections()
+	p.wg.Wait()
+	return err
+}
+
+func (p *FaultProxy) accept() {
+	defer p.wg.Done()
+
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+
+		c := &proxyConn{
+			proxy:  p,
+			client: client,
+			server: server,
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			client.Close()
+			server.Close()
+			return
+		}
+		p.conns[c] = true
+		p.mu.Unlock()
+
+		p.wg.Add(2)
+		go c.pipe(server, client)
+		go c.pipe(client, server)
+	}
+}
+
+type proxyConn struct {
+	proxy  *FaultProxy
+	client net.Conn
+	server net.Conn
+
+	mu          sync.Mutex
+	transferred int64
+	closeOnce   sync.Once
+}
+
+func (c *proxyConn) close(reset bool) {
+	c.closeOnce.Do(func() {
+		if tcpConn, ok := c.client.(*net.TCPConn); ok && reset {
+			tcpConn.SetLinger(0)
+		}
+		c.client.Close()
+		c.server.Close()
+
+		c.proxy.mu.Lock()
+		delete(c.proxy.conns, c)
+		c.proxy.mu.Unlock()
+	})
+}
+
+func (c *proxyConn) pipe(dst net.Conn, src net.Conn) {
+	defer c.proxy.wg.Done()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 && !c.forward(dst, buf[:n]) {
+			return
+		}
+		if err != nil {
+			c.close(false)
+			return
+		}
+	}
+}
+
+// forward returns false if connection has been closed.
+func (c *proxyConn) forward(dst net.Conn, data []byte) bool {
+	faults := c.proxy.Faults()
+
+	if faults.BlackHole {
+		return true
+	}
+
+	if faults.Latency > 0 {
+		time.Sleep(faults.Latency)
+	}
+
+	// cut data at the byte limit
+	limit, reset := faults.CloseAfter, false
+	if faults.ResetAfter > 0 && (limit == 0 || faults.ResetAfter < limit) {
+		limit, reset = faults.ResetAfter, true
+	}
+
+	cut := false
+	if limit > 0 {
+		c.mu.Lock()
+		rest := limit - c.transferred
+		if rest < 0 {
+			rest = 0
+		}
+		if int64(len(data)) >= rest {
+			data = data[:rest]
+			cut = true
+		}
+		c.transferred += int64(len(data))
+		c.mu.Unlock()
+	}
+
+	chunk := len(data)
+	if faults.SplitWrites > 0 && faults.SplitWrites < chunk {
+		chunk = faults.SplitWrites
+	}
+
+	for len(data) > 0 {
+		if chunk > len(data) {
+			chunk = len(data)
+		}
+		if faults.Bandwidth > 0 {
+			time.Sleep(time.Duration(chunk) * time.Second / time.Duration(faults.Bandwidth))
+		}
+		if _, err := dst.Write(data[:chunk]); err != nil {
+			c.close(false)
+			return false
+		}
+		data = data[chunk:]
+	}
+
+	if cut {
+		c.close(reset)
+		return false
+	}
+	return true
+}
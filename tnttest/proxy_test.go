@@ -0,0 +1,196 @@
+package tnttest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lomik/go-tnt"
+	"github.com/stretchr/testify/assert"
+)
+
+// pingServer replies to every iproto request with empty body
+func pingServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				header := make([]byte, 12)
+				for {
+					if _, err := io.ReadFull(c, header); err != nil {
+						return
+					}
+					body := make([]byte, tnt.UnpackInt(header[4:8]))
+					if _, err := io.ReadFull(c, body); err != nil {
+						return
+					}
+					copy(header[4:8], tnt.PackInt(0))
+					if _, err := c.Write(header); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+
+	return listener
+}
+
+func TestFaultProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	server := pingServer(t)
+	defer server.Close()
+
+	proxy, err := NewFaultProxy(server.Addr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer proxy.Close()
+
+	conn, err := tnt.Connect(proxy.Addr(), &tnt.Options{QueryTimeout: 100 * time.Millisecond})
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.NoError(err)
+
+	// reader gets reply by single bytes
+	proxy.SetFaults(Faults{SplitWrites: 1})
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.NoError(err)
+
+	proxy.SetFaults(Faults{Latency: 200 * time.Millisecond})
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.Equal(tnt.ErrResponseTimeout, err)
+	assert.False(conn.IsClosed())
+
+	proxy.SetFaults(Faults{BlackHole: true})
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.Equal(tnt.ErrResponseTimeout, err)
+	assert.False(conn.IsClosed())
+}
+
+func TestFaultProxyCloseAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	server := pingServer(t)
+	defer server.Close()
+
+	proxy, err := NewFaultProxy(server.Addr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer proxy.Close()
+
+	// request and half of the reply header
+	proxy.SetFaults(Faults{CloseAfter: 18})
+
+	conn, err := tnt.Connect(proxy.Addr(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.True(errors.Is(err, tnt.ErrConnectionClosed))
+	assert.True(errors.Is(conn.Err(), io.ErrUnexpectedEOF))
+}
+
+func TestFaultProxyResetAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	server := pingServer(t)
+	defer server.Close()
+
+	proxy, err := NewFaultProxy(server.Addr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer proxy.Close()
+
+	proxy.SetFaults(Faults{ResetAfter: 12})
+
+	conn, err := tnt.Connect(proxy.Addr(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.True(errors.Is(err, tnt.ErrConnectionClosed))
+	assert.True(errors.Is(conn.Err(), syscall.ECONNRESET))
+}
+
+func TestFaultProxyReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	server := pingServer(t)
+	defer server.Close()
+
+	proxy, err := NewFaultProxy(server.Addr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer proxy.Close()
+
+	connector := tnt.New(proxy.Addr(), nil)
+	defer connector.Close()
+
+	conn, err := connector.Connect()
+	if !assert.NoError(err) {
+		return
+	}
+
+	proxy.CloseConnections()
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.IsType(&tnt.ConnectionError{}, err)
+
+	conn, err = connector.Connect()
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.NoError(err)
+}
+
+func TestFaultProxyBandwidth(t *testing.T) {
+	assert := assert.New(t)
+
+	server := pingServer(t)
+	defer server.Close()
+
+	proxy, err := NewFaultProxy(server.Addr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer proxy.Close()
+
+	// 12 bytes of request and 12 bytes of reply at 240 bytes per second
+	proxy.SetFaults(Faults{Bandwidth: 240})
+
+	conn, err := tnt.Connect(proxy.Addr(), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	started := time.Now()
+	_, err = conn.Execute(&tnt.Ping{})
+	assert.NoError(err)
+	assert.True(time.Since(started) >= 100*time.Millisecond)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 )
 
 func UnpackInt(p []byte) uint32 {
@@ -79,6 +80,15 @@ func unpackTuple(p []byte) (Tuple, error) {
 func UnpackBody(body []byte) (*Response, error) {
 	var err error
 
+	// ping reply has empty body
+	if len(body) == 0 {
+		return &Response{Data: []Tuple{}}, nil
+	}
+
+	if len(body) < 4 {
+		return nil, errors.New("Response body is too short")
+	}
+
 	returnCode := UnpackInt(body[:4])
 
 	// completionStatus := returnCode % 0x100
@@ -91,7 +101,10 @@ func UnpackBody(body []byte) (*Response, error) {
 		if len(errorMsg) > 0 && errorMsg[len(errorMsg)-1] == 0x0 {
 			errorMsg = errorMsg[:len(errorMsg)-1]
 		}
-		response.Error = NewQueryError(string(errorMsg))
+		response.Error = &QueryError{
+			error: errors.New(string(errorMsg)),
+			Code:  returnCode,
+		}
 		return response, nil
 	}
 
@@ -124,3 +137,167 @@ func UnpackBody(body []byte) (*Response, error) {
 
 	return response, nil
 }
+
+// readTuple decodes tuple packed by packTuple and returns its length.
+func readTuple(p []byte) (Tuple, int, error) {
+	if len(p) < 4 {
+		return nil, 0, errors.New("Tuple is too short")
+	}
+	fieldsCount := int(UnpackInt(p[:4]))
+	if fieldsCount > len(p) {
+		return nil, 0, errors.New("Tuple is too short")
+	}
+
+	tuple := make(Tuple, fieldsCount)
+	offset := 4
+	for i := 0; i < fieldsCount; i++ {
+		field, n, err := readField(p[offset:])
+		if err != nil {
+			return nil, 0, err
+		}
+		tuple[i] = field
+		offset += n
+	}
+	return tuple, offset, nil
+}
+
+// readField decodes varint-prefixed field and returns its length with prefix.
+func readField(p []byte) (Bytes, int, error) {
+	length, n, err := unpackIntBase128(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	if uint64(n)+uint64(length) > uint64(len(p)) {
+		return nil, 0, errors.New("Field is too short")
+	}
+	return p[n : n+int(length)], n + int(length), nil
+}
+
+// UnpackQuery decodes the body of request packed by Query.Pack, requestType is from the request header.
+// Space of decoded query is uint32 and fields refer to body. Select limit is decoded as is,
+// so limit 0 of the request means 0xffffffff if the query is packed again (see Select.Limit).
+func UnpackQuery(requestType uint32, body []byte) (Query, error) {
+	switch requestType {
+	case requestTypePing:
+		return &Ping{}, nil
+	case requestTypeSelect:
+		return unpackSelect(body)
+	case requestTypeInsert:
+		if len(body) < 8 {
+			return nil, errors.New("Insert request is too short")
+		}
+		tuple, _, err := readTuple(body[8:])
+		if err != nil {
+			return nil, err
+		}
+		flags := UnpackInt(body[4:8])
+		return &Insert{
+			Space:       UnpackInt(body[0:4]),
+			Tuple:       tuple,
+			ReturnTuple: flags&flagReturnTuple != 0,
+			Mode:        InsertMode(flags &^ flagReturnTuple),
+		}, nil
+	case requestTypeUpdate:
+		return unpackUpdate(body)
+	case requestTypeDelete:
+		if len(body) < 8 {
+			return nil, errors.New("Delete request is too short")
+		}
+		tuple, _, err := readTuple(body[8:])
+		if err != nil {
+			return nil, err
+		}
+		return &Delete{
+			Space:       UnpackInt(body[0:4]),
+			Tuple:       tuple,
+			ReturnTuple: UnpackInt(body[4:8])&flagReturnTuple != 0,
+		}, nil
+	case requestTypeCall:
+		if len(body) < 4 {
+			return nil, errors.New("Call request is too short")
+		}
+		name, n, err := readField(body[4:])
+		if err != nil {
+			return nil, err
+		}
+		tuple, _, err := readTuple(body[4+n:])
+		if err != nil {
+			return nil, err
+		}
+		return &Call{
+			Name:        name,
+			Tuple:       tuple,
+			ReturnTuple: UnpackInt(body[0:4])&flagReturnTuple != 0,
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown request type %d", requestType)
+}
+
+func unpackSelect(body []byte) (Query, error) {
+	if len(body) < 20 {
+		return nil, errors.New("Select request is too short")
+	}
+	q := &Select{
+		Space:  UnpackInt(body[0:4]),
+		Index:  UnpackInt(body[4:8]),
+		Offset: UnpackInt(body[8:12]),
+		Limit:  UnpackInt(body[12:16]),
+	}
+
+	count := int(UnpackInt(body[16:20]))
+	if count > len(body) {
+		return nil, errors.New("Select request is too short")
+	}
+	q.Tuples = make([]Tuple, count)
+	offset := 20
+	for i := 0; i < count; i++ {
+		tuple, n, err := readTuple(body[offset:])
+		if err != nil {
+			return nil, err
+		}
+		q.Tuples[i] = tuple
+		offset += n
+	}
+	return q, nil
+}
+
+func unpackUpdate(body []byte) (Query, error) {
+	if len(body) < 8 {
+		return nil, errors.New("Update request is too short")
+	}
+	tuple, n, err := readTuple(body[8:])
+	if err != nil {
+		return nil, err
+	}
+	q := &Update{
+		Space:       UnpackInt(body[0:4]),
+		Tuple:       tuple,
+		ReturnTuple: UnpackInt(body[4:8])&flagReturnTuple != 0,
+	}
+
+	p := body[8+n:]
+	if len(p) == 0 {
+		return q, nil
+	}
+	if len(p) < 4 {
+		return nil, errors.New("Update request is too short")
+	}
+	count := int(UnpackInt(p[:4]))
+	if count > len(p) {
+		return nil, errors.New("Update request is too short")
+	}
+	p = p[4:]
+	q.Ops = make([]Operator, count)
+	for i := 0; i < count; i++ {
+		if len(p) < 5 {
+			return nil, errors.New("Update request is too short")
+		}
+		value, n, err := readField(p[5:])
+		if err != nil {
+			return nil, err
+		}
+		q.Ops[i] = Operator{Field: UnpackInt(p[0:4]), OpCode: OpCode(p[4]), Value: value}
+		p = p[5+n:]
+	}
+	return q, nil
+}
@@ -99,3 +99,53 @@ func TestUnpackBody1(t *testing.T) {
 	)
 	assert.NoError(response.Error)
 }
+
+func TestUnpackQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	queries := []Query{
+		&Ping{},
+		&Select{Space: uint32(1), Index: 2, Offset: 3, Limit: 4, Tuples: []Tuple{{Bytes("a"), Bytes("b")}, {}}},
+		&Select{Space: uint32(1), Limit: 0xffffffff, Tuples: []Tuple{}},
+		&Insert{Space: uint32(5), Tuple: Tuple{PackInt(1), Bytes("value")}, ReturnTuple: true, Mode: InsertAdd},
+		&Insert{Space: uint32(5), Tuple: Tuple{}, Mode: InsertReplace},
+		&Update{Space: uint32(6), Tuple: Tuple{PackInt(1)}, ReturnTuple: true, Ops: []Operator{
+			OpSet(1, Bytes("x")),
+			OpSplice(2, 1, 2, Bytes("yz")),
+			OpDelete(3, Bytes{}),
+		}},
+		&Delete{Space: uint32(7), Tuple: Tuple{PackLong(1)}},
+		&Call{Name: Bytes("box.select"), Tuple: Tuple{Bytes("1"), Bytes("0")}, ReturnTuple: true},
+	}
+
+	for _, q := range queries {
+		packed, err := q.Pack(42, 0)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		decoded, err := UnpackQuery(UnpackInt(packed[0:4]), packed[12:])
+		if !assert.NoError(err, "%#v", q) {
+			continue
+		}
+		assert.Equal(q, decoded)
+
+		repacked, err := decoded.Pack(42, 0)
+		assert.NoError(err)
+		assert.Equal(packed, repacked)
+
+		// truncated requests are rejected
+		for i := 12; i < len(packed)-1; i++ {
+			if _, err := UnpackQuery(UnpackInt(packed[0:4]), packed[12:i]); err == nil {
+				// update without operations and select without keys are complete
+				if _, ok := q.(*Update); ok && i == 12+8+len(packTuple(q.(*Update).Tuple)) {
+					continue
+				}
+				assert.Fail("truncated request is decoded", "%#v at %d", q, i)
+			}
+		}
+	}
+
+	_, err := UnpackQuery(1, nil)
+	assert.Error(err)
+}